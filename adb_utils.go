@@ -2,17 +2,43 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	adb "github.com/zach-klippenstein/goadb"
 )
 
-func checkAdb() bool {
-	_, err := getAdb()
+type deviceInfo struct {
+	serial string
+	model  string
+	state  adb.DeviceState
+}
+
+type adbSession struct {
+	device   *adb.Device
+	checked  time.Time
+	features []string
+}
+
+const sessionCheckInterval = 5 * time.Second
+
+var (
+	adbServer   = adb.ServerConfig{Host: "localhost", Port: adb.AdbPort}
+	adbClient   *adb.Adb
+	clientLock  sync.Mutex
+	sessions    = make(map[string]*adbSession)
+	sessionLock sync.Mutex
+)
+
+func checkAdb(serial string) bool {
+	_, err := getAdb(serial)
 	if err != nil {
 		showErrorMsg(err, false)
 		return false
@@ -21,85 +47,386 @@ func checkAdb() bool {
 	return true
 }
 
-func getAdb() (*adb.Device, error) {
-	client, err := adb.NewWithConfig(adb.ServerConfig{})
+func setAdbServer(host string, port int) error {
+	if socket := os.Getenv("ADB_SERVER_SOCKET"); socket != "" {
+		address := strings.TrimPrefix(socket, "tcp:")
+		if address == socket {
+			return fmt.Errorf("%s: Unsupported ADB_SERVER_SOCKET", socket)
+		}
+
+		shost, sport, err := net.SplitHostPort(address)
+		if err != nil {
+			shost, sport = "", address
+		}
+
+		if host == "" {
+			host = shost
+		}
+
+		if port == 0 {
+			port, err = strconv.Atoi(sport)
+			if err != nil {
+				return fmt.Errorf("%s: Invalid ADB_SERVER_SOCKET", socket)
+			}
+		}
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	if port == 0 {
+		port = adb.AdbPort
+	}
+
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("%d: Invalid ADB server port", port)
+	}
+
+	adbServer.Host = host
+	adbServer.Port = port
+
+	return nil
+}
+
+func getServerAddress() string {
+	return net.JoinHostPort(adbServer.Host, strconv.Itoa(adbServer.Port))
+}
+
+func getClient() (*adb.Adb, error) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if adbClient != nil {
+		return adbClient, nil
+	}
+
+	client, err := adb.NewWithConfig(adbServer)
 	if err != nil {
 		return nil, fmt.Errorf("ADB client not found")
 	}
 
-	device := client.Device(adb.AnyDevice())
+	adbClient = client
+
+	return adbClient, nil
+}
+
+func getAdb(serial string) (*adb.Device, error) {
+	sessionLock.Lock()
+	defer sessionLock.Unlock()
+
+	session, ok := sessions[serial]
+	if ok && time.Since(session.checked) < sessionCheckInterval {
+		return session.device, nil
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	device := client.Device(getDescriptor(serial))
 
 	state, err := device.State()
 	if err != nil || state != adb.StateOnline {
+		delete(sessions, serial)
 		return nil, fmt.Errorf("ADB device not found")
 	}
 
+	if ok {
+		session.checked = time.Now()
+	} else {
+		sessions[serial] = &adbSession{device: device, checked: time.Now()}
+	}
+
 	return device, nil
 }
 
-func isAdbSymDir(testPath, name string) bool {
-	device, err := getAdb()
+func getFeatures(serial string) []string {
+	sessionLock.Lock()
+	session, ok := sessions[serial]
+	sessionLock.Unlock()
+
+	if ok && session.features != nil {
+		return session.features
+	}
+
+	req := "host:features"
+	if serial != "" {
+		req = "host-serial:" + serial + ":features"
+	}
+
+	resp, err := hostRequest(req)
 	if err != nil {
-		return false
+		return nil
+	}
+
+	features := strings.Split(resp, ",")
+
+	if ok {
+		sessionLock.Lock()
+		session.features = features
+		sessionLock.Unlock()
 	}
 
-	cmd := fmt.Sprintf("ls -pd %s%s/", testPath, name)
-	out, err := device.RunCommand(cmd)
+	return features
+}
+
+func invalidateSession(serial string) {
+	sessionLock.Lock()
+	defer sessionLock.Unlock()
+
+	delete(sessions, serial)
+	delete(sessions, "")
+}
+
+func getDescriptor(serial string) adb.DeviceDescriptor {
+	if serial == "" {
+		return adb.AnyDevice()
+	}
+
+	return adb.DeviceWithSerial(serial)
+}
+
+func getDevices() ([]deviceInfo, error) {
+	var devices []deviceInfo
+
+	client, err := getClient()
 	if err != nil {
-		return false
+		return nil, err
 	}
 
-	if !strings.HasSuffix(strings.TrimSpace(out), "//") {
-		return false
+	list, err := client.ListDevices()
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	for _, dev := range list {
+		state, err := client.Device(adb.DeviceWithSerial(dev.Serial)).State()
+		if err != nil {
+			state = adb.StateInvalid
+		}
+
+		devices = append(devices, deviceInfo{
+			serial: dev.Serial,
+			model:  dev.Model,
+			state:  state,
+		})
+	}
+
+	if devices == nil {
+		return nil, fmt.Errorf("No ADB devices found")
+	}
+
+	return devices, nil
+}
+
+func getDefaultSerial() string {
+	devices, err := getDevices()
+	if err != nil {
+		return ""
+	}
+
+	for _, dev := range devices {
+		if dev.state == adb.StateOnline {
+			return dev.serial
+		}
+	}
+
+	return ""
+}
+
+func hostRequest(req string) (string, error) {
+	client, err := getClient()
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := client.Dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	resp, err := conn.RoundTripSingleResponse([]byte(req))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(resp)), nil
+}
+
+func getEndpoint(address string) (string, error) {
+	address = strings.TrimSpace(address)
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "5555"
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("%s: Invalid address", address)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func connectDevice(address string) (string, error) {
+	endpoint, err := getEndpoint(address)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := hostRequest("host:connect:" + endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(resp, "connected to") &&
+		!strings.HasPrefix(resp, "already connected") {
+		return "", errors.New(resp)
+	}
+
+	saveEndpoint(endpoint)
+
+	return endpoint, nil
+}
+
+func pairDevice(address, code string) (string, error) {
+	endpoint, err := getEndpoint(address)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := hostRequest(fmt.Sprintf("host:pair:%s:%s", code, endpoint))
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(resp, "Successfully paired") {
+		return "", errors.New(resp)
+	}
+
+	return endpoint, nil
+}
+
+func adbCmdArgs(serial string, args ...string) []string {
+	cmdArgs := []string{"-L", "tcp:" + getServerAddress()}
+
+	if serial != "" {
+		cmdArgs = append(cmdArgs, "-s", serial)
+	}
+
+	return append(cmdArgs, args...)
+}
+
+func (d deviceInfo) String() string {
+	var state string
+
+	switch d.state {
+	case adb.StateOnline:
+		state = "online"
+
+	case adb.StateOffline:
+		state = "offline"
+
+	case adb.StateUnauthorized:
+		state = "unauthorized"
+
+	default:
+		state = "disconnected"
+	}
+
+	model := d.model
+	if model == "" {
+		model = "unknown"
+	}
+
+	return fmt.Sprintf("%s (%s, %s)", d.serial, model, state)
 }
 
 func (o *operation) adbOps(src, dst string) error {
 	var err error
 
-	device, err := getAdb()
+	access := o.srcDev
+	switch o.transfer {
+	case localToAdb:
+		access = o.dstDev
+
+	case adbToAdb:
+		access.root = o.srcDev.root || o.dstDev.root
+		if access.runas == "" {
+			access.runas = o.dstDev.runas
+		}
+	}
+
+	device, err := getDevice(access)
 	if err != nil {
 		return err
 	}
 
 	switch o.transfer {
 	case adbToAdb:
+		if o.opmode == opCopy {
+			err = o.copyAdbRecursive(src, dst, device)
+			break
+		}
+
 		err = o.execAdbCmd(src, dst, device)
 
 	case localToAdb:
+		if o.useTar(src, dst, device) {
+			err = o.pushTar(src, dst, device)
+			break
+		}
+
 		err = o.pushRecursive(src, dst, device)
 
 	case adbToLocal:
+		if o.useTar(src, dst, device) {
+			err = o.pullTar(src, dst, device)
+			break
+		}
+
 		err = o.pullRecursive(src, dst, device)
+
+	case deviceToDevice:
+		var dstDevice *adbDevice
+
+		dstDevice, err = getDevice(o.dstDev)
+		if err != nil {
+			return err
+		}
+
+		err = o.transferRecursive(src, dst, device, dstDevice)
+	}
+
+	if err != nil && err != context.Canceled && o.opmode == opMove && o.byteProgress() {
+		err = fmt.Errorf("%s (partially moved, resume from the operations page)", err.Error())
 	}
 
 	return err
 }
 
-func (o *operation) execAdbCmd(src, dst string, device *adb.Device) error {
+func (o *operation) execAdbCmd(src, dst string, device *adbDevice) error {
 	var cmd string
 
-	srcfmt := fmt.Sprintf(" '%s'", src)
-	dstfmt := fmt.Sprintf(" '%s'", dst)
-
-	param := srcfmt + dstfmt
+	param := []string{src, dst}
 
 	switch o.opmode {
 	case opMkdir:
 		cmd = "mkdir"
-		param = srcfmt
+		param = param[:1]
 
 	default:
-		stat, err := device.Stat(src)
+		stat, err := device.stat(src)
 		if err != nil {
 			return err
 		}
 
 		switch o.opmode {
 		case opRename:
-			_, err := device.Stat(dst)
+			_, err := device.stat(dst)
 			if err == nil {
 				return fmt.Errorf("rename %s %s: file exists", src, dst)
 			}
@@ -109,13 +436,6 @@ func (o *operation) execAdbCmd(src, dst string, device *adb.Device) error {
 		case opMove:
 			cmd = "mv"
 
-		case opCopy:
-			if stat.Mode.IsDir() {
-				cmd = "cp -r"
-			} else {
-				cmd = "cp"
-			}
-
 		case opDelete:
 			if stat.Mode.IsDir() {
 				cmd = "rm -rf"
@@ -123,23 +443,38 @@ func (o *operation) execAdbCmd(src, dst string, device *adb.Device) error {
 				cmd = "rm"
 			}
 
-			param = srcfmt
+			param = param[:1]
 		}
 	}
 
-	cmd = cmd + param
-	out, err := exec.CommandContext(o.ctx, "adb", "shell", cmd).Output()
-
+	out, err := device.runContext(o.ctx, shellJoin(cmd, param...))
 	if err != nil {
-		if err.Error() == "signal: killed" {
-			return error(context.Canceled)
-		}
+		return err
+	}
+
+	if out != "" {
+		return errors.New(strings.TrimSpace(out))
+	}
 
+	return nil
+}
+
+func makeAdbDir(dst string, perms os.FileMode, device *adbDevice) error {
+	cmd := shellJoin("mkdir -p", dst)
+	out, err := device.runCommand(cmd)
+	if err != nil {
 		return err
+	} else if out != "" {
+		return errors.New(out)
 	}
 
-	if string(out) != "" {
-		return fmt.Errorf(string(out))
+	mode := fmt.Sprintf("chmod %04o", perms.Perm())
+	cmd = shellJoin(mode, dst)
+	out, err = device.runCommand(cmd)
+	if err != nil {
+		return err
+	} else if out != "" {
+		return errors.New(out)
 	}
 
 	return nil
@@ -148,30 +483,33 @@ func (o *operation) execAdbCmd(src, dst string, device *adb.Device) error {
 func (p *dirPane) adbListDir(testPath string, autocomplete bool) ([]string, bool) {
 	var dlist []string
 
-	device, err := getAdb()
+	device, err := getDevice(p.deviceAccess)
 	if err != nil {
 		showErrorMsg(err, autocomplete)
 		return nil, false
 	}
 
-	_, err = device.Stat(testPath)
+	_, err = device.stat(testPath)
 	if err != nil {
 		showErrorMsg(err, autocomplete)
 		return nil, false
 	}
 
-	dent, err := device.ListDirEntries(testPath)
+	list, err := device.listDir(testPath)
 	if err != nil {
 		showErrorMsg(err, autocomplete)
 		return nil, false
 	}
 
+	if err := device.resolveLinks(testPath, list); err != nil {
+		showErrorMsg(err, autocomplete)
+	}
+
 	if !autocomplete {
 		p.pathList = nil
 	}
 
-	for dent.Next() {
-		ent := dent.Entry()
+	for _, ent := range list {
 		name := ent.Name
 
 		if name == ".." || name == "." {
@@ -182,7 +520,7 @@ func (p *dirPane) adbListDir(testPath string, autocomplete bool) ([]string, bool
 			continue
 		}
 
-		if ent.Mode&os.ModeDir != 0 {
+		if ent.Mode&os.ModeDir != 0 || ent.LinkDir {
 			dlist = append(dlist, filepath.Join(testPath, name))
 		}
 
@@ -192,9 +530,6 @@ func (p *dirPane) adbListDir(testPath string, autocomplete bool) ([]string, bool
 
 		p.pathList = append(p.pathList, ent)
 	}
-	if dent.Err() != nil {
-		return nil, false
-	}
 
 	return dlist, true
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkListDir reports the requests made to the ADB server per
+// directory listing, with a reused session and with a new session for
+// every listing, as was done before sessions were shared.
+func BenchmarkListDir(b *testing.B) {
+	for _, reuse := range []bool{true, false} {
+		name := "reused"
+		if !reuse {
+			name = "new"
+		}
+
+		reuse := reuse
+
+		b.Run(name, func(b *testing.B) {
+			device := newFakeAdb(b)
+
+			tree := make(map[string]string)
+			for i := 0; i < 100; i++ {
+				tree[fmt.Sprintf("dir%02d/file", i)] = "data"
+				tree[fmt.Sprintf("file%02d", i)] = "data"
+			}
+
+			writeTree(b, device.path("/sdcard"), tree)
+
+			pane := newTestPane(mAdb, "/sdcard")
+
+			b.ResetTimer()
+			device.resetRequests()
+
+			for i := 0; i < b.N; i++ {
+				if !reuse {
+					invalidateSession(fakeSerial)
+				}
+
+				if _, ok := pane.adbListDir("/sdcard", false); !ok {
+					b.Fatal("listing failed")
+				}
+
+				if len(pane.pathList) != len(tree) {
+					b.Fatalf("listed %d entries, want %d", len(pane.pathList), len(tree))
+				}
+			}
+
+			b.ReportMetric(float64(device.requestCount())/float64(b.N), "requests/op")
+		})
+	}
+}
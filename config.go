@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var configLock sync.Mutex
+
+func configPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir = filepath.Join(dir, "adbtuifm")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+func loadEndpoints() []string {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	var endpoints []string
+
+	cpath, err := configPath("connections")
+	if err != nil {
+		return nil
+	}
+
+	file, err := os.Open(cpath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		endpoint := strings.TrimSpace(scanner.Text())
+		if endpoint == "" {
+			continue
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints
+}
+
+func saveEndpoint(endpoint string) error {
+	endpoints := loadEndpoints()
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for _, e := range endpoints {
+		if e == endpoint {
+			return nil
+		}
+	}
+
+	cpath, err := configPath("connections")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(cpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(endpoint + "\n")
+
+	return err
+}
@@ -0,0 +1,720 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	adb "github.com/zach-klippenstein/goadb"
+	"github.com/zach-klippenstein/goadb/wire"
+)
+
+type deviceAccess struct {
+	serial string
+	runas  string
+	root   bool
+}
+
+type adbDevice struct {
+	*adb.Device
+	deviceAccess
+}
+
+type shellWriter struct {
+	io.WriteCloser
+
+	dst    string
+	tmp    string
+	perms  os.FileMode
+	device *adbDevice
+}
+
+type appendWriter struct {
+	net.Conn
+}
+
+type syncStat struct {
+	ID    [4]byte
+	Error uint32
+	Dev   uint64
+	Ino   uint64
+	Mode  uint32
+	Nlink uint32
+	UID   uint32
+	GID   uint32
+	Size  uint64
+	Atime int64
+	Mtime int64
+	Ctime int64
+}
+
+type syncDent struct {
+	Stat    syncStat
+	NameLen uint32
+}
+
+const shellStatFormat = "'%f %s %Y %n'"
+
+func getDevice(access deviceAccess) (*adbDevice, error) {
+	device, err := getAdb(access.serial)
+	if err != nil {
+		return nil, err
+	}
+
+	return &adbDevice{device, access}, nil
+}
+
+func checkRoot(serial string) error {
+	device, err := getDevice(deviceAccess{serial: serial, root: true})
+	if err != nil {
+		return err
+	}
+
+	out, err := device.runCommand("id -u")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out) != "0" {
+		return fmt.Errorf("Root access is not available on %s", device.String())
+	}
+
+	return nil
+}
+
+func checkRunAs(serial, pkg string) error {
+	device, err := getDevice(deviceAccess{serial: serial, runas: pkg})
+	if err != nil {
+		return err
+	}
+
+	out, err := device.runCommand("id -u")
+	if err != nil {
+		return err
+	}
+
+	if _, err := strconv.Atoi(strings.TrimSpace(out)); err != nil {
+		return errors.New(strings.TrimSpace(out))
+	}
+
+	return nil
+}
+
+func getPackages(serial string) ([]string, error) {
+	var packages []string
+
+	device, err := getAdb(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := device.RunCommand("pm list packages -3")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		pkg := strings.TrimPrefix(strings.TrimSpace(line), "package:")
+		if pkg == "" {
+			continue
+		}
+
+		packages = append(packages, pkg)
+	}
+
+	if packages == nil {
+		return nil, fmt.Errorf("No packages found")
+	}
+
+	sort.Strings(packages)
+
+	return packages, nil
+}
+
+func (d *adbDevice) shellCmd(cmd string) string {
+	switch {
+	case d.root:
+		return "su -c " + shellQuote(cmd)
+
+	case d.runas != "":
+		return "run-as " + shellQuote(d.runas) + " sh -c " + shellQuote(cmd)
+	}
+
+	return cmd
+}
+
+func (d *adbDevice) shellAccess() bool {
+	return d.root || d.runas != ""
+}
+
+func (d *adbDevice) runCommand(cmd string) (string, error) {
+	return d.RunCommand(d.shellCmd(cmd))
+}
+
+func (d *adbDevice) runContext(ctx context.Context, cmd string) (string, error) {
+	conn, err := d.execConn("echo $$; exec " + cmd + " 2>&1")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	pid, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.runCommand("kill " + strings.TrimSpace(pid))
+			conn.Close()
+
+		case <-done:
+		}
+	}()
+
+	out, err := ioutil.ReadAll(reader)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	return string(out), err
+}
+
+func (d *adbDevice) stat(path string) (*dirEntry, error) {
+	if !d.shellAccess() {
+		if d.hasFeature("stat_v2") {
+			return d.syncStat(path)
+		}
+
+		if entry, err := d.shellStat(path); err == nil {
+			return entry, nil
+		}
+
+		entry, err := d.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return newDirEntry(entry), nil
+	}
+
+	return d.shellStat(path)
+}
+
+func (d *adbDevice) shellStat(path string) (*dirEntry, error) {
+	cmd := fmt.Sprintf("stat -c %s %s", shellStatFormat, shellPath(path))
+
+	entries, err := d.shellStatList(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: No such file or directory", path)
+	}
+
+	return entries[0], nil
+}
+
+func (d *adbDevice) listDir(path string) ([]*dirEntry, error) {
+	if !d.shellAccess() {
+		if d.hasFeature("ls_v2") {
+			return d.syncList(path)
+		}
+
+		if entries, err := d.shellList(path); err == nil {
+			return entries, nil
+		}
+
+		return d.syncListV1(path)
+	}
+
+	return d.shellList(path)
+}
+
+func (d *adbDevice) syncListV1(path string) ([]*dirEntry, error) {
+	var entries []*dirEntry
+
+	dent, err := d.ListDirEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := dent.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range list {
+		entries = append(entries, newDirEntry(entry))
+	}
+
+	return entries, nil
+}
+
+func (d *adbDevice) shellList(path string) ([]*dirEntry, error) {
+	cmd := fmt.Sprintf(
+		"find %s -mindepth 1 -maxdepth 1 -exec stat -c %s {} +",
+		shellPath(path), shellStatFormat,
+	)
+
+	return d.shellStatList(cmd)
+}
+
+func (d *adbDevice) shellStatList(cmd string) ([]*dirEntry, error) {
+	var entries []*dirEntry
+
+	out, err := d.runCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimRight(scanner.Text(), "\r"), " ", 4)
+		if len(fields) != 4 {
+			return nil, errors.New(strings.TrimSpace(out))
+		}
+
+		mode, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, errors.New(strings.TrimSpace(out))
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		mtime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &dirEntry{
+			Name:       filepath.Base(fields[3]),
+			Mode:       wire.ParseFileModeFromAdb(uint32(mode)),
+			Size:       size,
+			ModifiedAt: time.Unix(mtime, 0),
+		})
+	}
+
+	return entries, scanner.Err()
+}
+
+func (d *adbDevice) resolveLinks(dir string, entries []*dirEntry) error {
+	var links []*dirEntry
+	var names []string
+
+	for _, entry := range entries {
+		if entry.Mode&os.ModeSymlink != 0 {
+			links = append(links, entry)
+			names = append(names, shellPath(entry.Name))
+		}
+	}
+
+	if links == nil {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(
+		"cd %s && for f in %s; do echo \"$(readlink \"$f\")\"; "+
+			"if [ -d \"$f\" ]; then echo d; else echo -; fi; done",
+		shellPath(dir), strings.Join(names, " "),
+	)
+
+	out, err := d.runCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(out, "\r", ""), "\n")
+	if len(lines) < 2*len(links) {
+		return errors.New(strings.TrimSpace(out))
+	}
+
+	for i, link := range links {
+		link.LinkTarget = lines[2*i]
+		link.LinkDir = lines[2*i+1] == "d"
+	}
+
+	return nil
+}
+
+func (d *adbDevice) checksum(path string) (string, error) {
+	out, err := d.runCommand(shellJoin("md5sum", path))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) == 0 || len(fields[0]) != 32 {
+		return "", errors.New(strings.TrimSpace(out))
+	}
+
+	return fields[0], nil
+}
+
+func (d *adbDevice) targetSize(path string) (int64, error) {
+	out, err := d.runCommand(shellJoin("stat -L -c %s", path))
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, errors.New(strings.TrimSpace(out))
+	}
+
+	return size, nil
+}
+
+func (d *adbDevice) totalSize(path string) (int, int64, error) {
+	var files int
+	var bytes int64
+
+	out, err := d.runCommand(shellJoin("find", path) + " -type f -exec stat -c %s {} +")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Unreadable directories are reported inline, and are skipped.
+	for _, line := range strings.Split(out, "\n") {
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		files++
+		bytes += size
+	}
+
+	if files == 0 && strings.TrimSpace(out) != "" {
+		return d.walkSize(path)
+	}
+
+	return files, bytes, nil
+}
+
+func (d *adbDevice) walkSize(path string) (int, int64, error) {
+	stat, err := d.stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !stat.Mode.IsDir() {
+		return 1, stat.Size, nil
+	}
+
+	list, err := d.listDir(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var files int
+	var bytes int64
+
+	for _, entry := range list {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		switch {
+		case entry.Mode.IsDir():
+			f, b, err := d.walkSize(filepath.Join(path, entry.Name))
+			if err != nil {
+				return 0, 0, err
+			}
+
+			files += f
+			bytes += b
+
+		case entry.Mode.IsRegular():
+			files++
+			bytes += entry.Size
+		}
+	}
+
+	return files, bytes, nil
+}
+
+func (d *adbDevice) openRead(path string) (io.ReadCloser, error) {
+	if !d.shellAccess() {
+		return d.OpenRead(path)
+	}
+
+	return d.execOut(shellJoin("cat", path))
+}
+
+func (d *adbDevice) openReadFrom(path string, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return d.openRead(path)
+	}
+
+	return d.execOut(fmt.Sprintf("tail -c +%d %s", offset+1, shellPath(path)))
+}
+
+func (d *adbDevice) openAppend(path string) (io.WriteCloser, error) {
+	conn, err := d.execConn(shellJoin("cat >>", path))
+	if err != nil {
+		return nil, err
+	}
+
+	return &appendWriter{conn}, nil
+}
+
+func (w *appendWriter) Close() error {
+	defer w.Conn.Close()
+
+	if tcp, ok := w.Conn.(*net.TCPConn); ok {
+		if err := tcp.CloseWrite(); err != nil {
+			return err
+		}
+	}
+
+	out, err := ioutil.ReadAll(w.Conn)
+	if err != nil {
+		return err
+	} else if len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (d *adbDevice) openWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error) {
+	if !d.shellAccess() {
+		return d.OpenWrite(path, perms, mtime)
+	}
+
+	tmp := fmt.Sprintf("/data/local/tmp/.adbtuifm-%d-%s", time.Now().UnixNano(), filepath.Base(path))
+
+	// The staged file must be readable by the package's user in run-as mode.
+	writer, err := d.OpenWrite(tmp, perms|0444, mtime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shellWriter{
+		WriteCloser: writer,
+		dst:         path,
+		tmp:         tmp,
+		perms:       perms,
+		device:      d,
+	}, nil
+}
+
+func (w *shellWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	defer w.device.RunCommand(shellJoin("rm -f", w.tmp))
+
+	cmd := fmt.Sprintf(
+		"%s > %s && %s",
+		shellJoin("cat", w.tmp), shellPath(w.dst),
+		shellJoin(fmt.Sprintf("chmod %04o", w.perms.Perm()), w.dst),
+	)
+
+	out, err := w.device.runCommand(cmd)
+	if err != nil {
+		return err
+	} else if out != "" {
+		return errors.New(strings.TrimSpace(out))
+	}
+
+	return nil
+}
+
+func (d *adbDevice) syncStat(path string) (*dirEntry, error) {
+	var st syncStat
+
+	conn, err := d.dialService("sync:")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := sendSyncRequest(conn, "LST2", path); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(conn, binary.LittleEndian, &st); err != nil {
+		return nil, err
+	}
+
+	if string(st.ID[:]) != "LST2" {
+		return nil, fmt.Errorf("%s: Invalid stat response", path)
+	}
+
+	if st.Error != 0 {
+		return nil, fmt.Errorf("%s: %s", path, syscall.Errno(st.Error).Error())
+	}
+
+	return newSyncEntry(filepath.Base(path), st), nil
+}
+
+func (d *adbDevice) syncList(path string) ([]*dirEntry, error) {
+	var entries []*dirEntry
+
+	conn, err := d.dialService("sync:")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := sendSyncRequest(conn, "LIS2", path); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		var dent syncDent
+
+		if err := binary.Read(reader, binary.LittleEndian, &dent); err != nil {
+			return nil, err
+		}
+
+		name := make([]byte, dent.NameLen)
+		if _, err := io.ReadFull(reader, name); err != nil {
+			return nil, err
+		}
+
+		switch string(dent.Stat.ID[:]) {
+		case "DONE":
+			return entries, nil
+
+		case "DNT2":
+
+		default:
+			return nil, fmt.Errorf("%s: Invalid list response", path)
+		}
+
+		if dent.Stat.Error != 0 || string(name) == "." || string(name) == ".." {
+			continue
+		}
+
+		entries = append(entries, newSyncEntry(string(name), dent.Stat))
+	}
+}
+
+func sendSyncRequest(conn net.Conn, id, path string) error {
+	req := make([]byte, 8, 8+len(path))
+
+	copy(req, id)
+	binary.LittleEndian.PutUint32(req[4:], uint32(len(path)))
+
+	_, err := conn.Write(append(req, path...))
+
+	return err
+}
+
+func newSyncEntry(name string, st syncStat) *dirEntry {
+	return &dirEntry{
+		Name:       name,
+		Mode:       wire.ParseFileModeFromAdb(st.Mode),
+		Size:       int64(st.Size),
+		ModifiedAt: time.Unix(st.Mtime, 0),
+	}
+}
+
+func newDirEntry(entry *adb.DirEntry) *dirEntry {
+	return &dirEntry{
+		Name:       entry.Name,
+		Mode:       entry.Mode,
+		Size:       int64(entry.Size),
+		ModifiedAt: entry.ModifiedAt,
+	}
+}
+
+func (d *adbDevice) hasFeature(feature string) bool {
+	for _, f := range getFeatures(d.serial) {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *adbDevice) execOut(cmd string) (io.ReadCloser, error) {
+	return d.execConn(cmd)
+}
+
+func (d *adbDevice) execConn(cmd string) (net.Conn, error) {
+	return d.dialService("exec:" + d.shellCmd(cmd))
+}
+
+func (d *adbDevice) dialService(service string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", getServerAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	transport := "host:transport-any"
+	if d.serial != "" {
+		transport = "host:transport:" + d.serial
+	}
+
+	for _, req := range []string{transport, service} {
+		if err := sendRequest(conn, req); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func sendRequest(conn net.Conn, req string) error {
+	status := make([]byte, 4)
+
+	_, err := fmt.Fprintf(conn, "%04x%s", len(req), req)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return err
+	}
+
+	if string(status) == wire.StatusSuccess {
+		return nil
+	}
+
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return fmt.Errorf("%s: request failed", req)
+	}
+
+	size, err := strconv.ParseUint(string(length), 16, 32)
+	if err != nil {
+		return err
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%s: %s", req, msg)
+}
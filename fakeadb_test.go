@@ -0,0 +1,1353 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	adb "github.com/zach-klippenstein/goadb"
+)
+
+// fakeAdb is an ADB server with a single device, whose
+// filesystem is a temporary directory on the local machine.
+type fakeAdb struct {
+	root     string
+	serial   string
+	features []string
+	listener net.Listener
+	requests int64
+	short    map[string]int64
+	archives map[string]fakeArchive
+	last     chan struct{}
+	lock     sync.Mutex
+}
+
+// fakeArchive is the output and exit status of tar for a tree.
+type fakeArchive struct {
+	data   []byte
+	status int
+}
+
+type fakeConn struct {
+	net.Conn
+
+	ready chan struct{}
+	once  sync.Once
+}
+
+type fakeShell struct {
+	device *fakeAdb
+	cwd    string
+	status int
+}
+
+type shellWord struct {
+	text   string
+	quoted bool
+}
+
+type shellFunc func(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int
+
+const (
+	fakeSerial = "fake-1"
+
+	// $? is expanded when a command runs, not when it is parsed.
+	statusMarker = "\x00?"
+)
+
+var shellFuncs map[string]shellFunc
+
+func init() {
+	shellFuncs = map[string]shellFunc{
+		"cat":     shellCat,
+		"chmod":   shellChmod,
+		"command": shellCommand,
+		"cp":      shellCp,
+		"echo":    shellEcho,
+		"find":    shellFind,
+		"kill":    shellTrue,
+		"mkdir":   shellMkdir,
+		"mv":      shellMv,
+		"rm":      shellRm,
+		"rmdir":   shellRmdir,
+		"stat":    shellStat,
+		"su":      shellSu,
+		"tar":     shellTar,
+	}
+}
+
+// newFakeAdb starts a fake ADB server, and points the ADB client at it.
+// The device supports sync v2 if the features include stat_v2 and ls_v2.
+func newFakeAdb(t testing.TB, features ...string) *fakeAdb {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client only starts the adb binary if the server cannot be reached.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeAdb{
+		root:     t.TempDir(),
+		serial:   fakeSerial,
+		features: features,
+		listener: listener,
+	}
+
+	go f.accept()
+
+	clientLock.Lock()
+	adbServer = adb.ServerConfig{
+		PathToAdb: exe,
+		Host:      "127.0.0.1",
+		Port:      listener.Addr().(*net.TCPAddr).Port,
+	}
+	adbClient = nil
+	clientLock.Unlock()
+
+	sessionLock.Lock()
+	sessions = make(map[string]*adbSession)
+	sessionLock.Unlock()
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	return f
+}
+
+// path returns the local path of a path on the device.
+func (f *fakeAdb) path(p string) string {
+	return filepath.Join(f.root, filepath.Clean("/"+p))
+}
+
+// shortRead makes reads of the file at path stop after n bytes,
+// as if the file was cut short while it was being read.
+func (f *fakeAdb) shortRead(path string, n int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.short == nil {
+		f.short = make(map[string]int64)
+	}
+
+	f.short[f.path(path)] = n
+}
+
+// setArchive makes tar write data and exit with status,
+// when it is run on the tree at path.
+func (f *fakeAdb) setArchive(path string, data []byte, status int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.archives == nil {
+		f.archives = make(map[string]fakeArchive)
+	}
+
+	f.archives[path] = fakeArchive{data, status}
+}
+
+// open opens the file at a local path for reading by the client.
+func (f *fakeAdb) open(local string) (io.ReadCloser, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+
+	f.lock.Lock()
+	n, ok := f.short[local]
+	f.lock.Unlock()
+
+	if !ok {
+		return file, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, n), file}, nil
+}
+
+func (f *fakeAdb) resetRequests() {
+	atomic.StoreInt64(&f.requests, 0)
+}
+
+func (f *fakeAdb) requestCount() int64 {
+	return atomic.LoadInt64(&f.requests)
+}
+
+// accept serves each connection once the previous one has started its
+// service. A file sent via sync is not acknowledged to the client, which
+// may go on to check the file before the previous connection has
+// written all of it.
+func (f *fakeAdb) accept() {
+	prev := make(chan struct{})
+	close(prev)
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &fakeConn{Conn: conn, ready: make(chan struct{})}
+		go f.serve(c, prev)
+
+		f.lock.Lock()
+		f.last = c.ready
+		f.lock.Unlock()
+
+		prev = c.ready
+	}
+}
+
+// settle waits until the files sent by the client have been written.
+func (f *fakeAdb) settle() {
+	f.lock.Lock()
+	last := f.last
+	f.lock.Unlock()
+
+	if last == nil {
+		return
+	}
+
+	select {
+	case <-last:
+
+	case <-time.After(time.Second):
+	}
+}
+
+func (c *fakeConn) release() {
+	c.once.Do(func() {
+		close(c.ready)
+	})
+}
+
+func (f *fakeAdb) serve(conn *fakeConn, prev chan struct{}) {
+	defer conn.release()
+	defer conn.Close()
+
+	select {
+	case <-prev:
+
+	case <-time.After(time.Second):
+	}
+
+	transport := false
+
+	for {
+		req, err := readRequest(conn)
+		if err != nil {
+			return
+		}
+
+		atomic.AddInt64(&f.requests, 1)
+
+		switch {
+		case req == "host:version":
+			writeReply(conn, "0029")
+
+		case req == "host:devices" || req == "host:devices-l":
+			writeReply(conn, f.serial+"\tdevice product:fake model:Fake device:fake\n")
+
+		case req == "host:get-state" || req == "host-serial:"+f.serial+":get-state":
+			writeReply(conn, "device")
+
+		case req == "host:features" || req == "host-serial:"+f.serial+":features":
+			writeReply(conn, strings.Join(f.features, ","))
+
+		case req == "host:transport-any" || req == "host:transport:"+f.serial:
+			conn.Write([]byte("OKAY"))
+			transport = true
+
+		case transport && strings.HasPrefix(req, "shell:"):
+			conn.Write([]byte("OKAY"))
+			conn.release()
+			f.shell().run(strings.TrimPrefix(req, "shell:"), bytes.NewReader(nil), conn)
+			return
+
+		case transport && strings.HasPrefix(req, "exec:"):
+			conn.Write([]byte("OKAY"))
+			conn.release()
+			f.shell().run(strings.TrimPrefix(req, "exec:"), conn, conn)
+			return
+
+		case transport && req == "sync:":
+			conn.Write([]byte("OKAY"))
+			f.sync(conn)
+			return
+
+		case strings.HasPrefix(req, "host:transport:") || strings.HasPrefix(req, "host-serial:"):
+			writeFailure(conn, "device '"+req+"' not found")
+			return
+
+		default:
+			writeFailure(conn, "unknown request "+req)
+			return
+		}
+	}
+}
+
+func readRequest(r io.Reader) (string, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return "", err
+	}
+
+	size, err := strconv.ParseUint(string(length), 16, 32)
+	if err != nil {
+		return "", err
+	}
+
+	req := make([]byte, size)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return "", err
+	}
+
+	return string(req), nil
+}
+
+func writeReply(w io.Writer, msg string) {
+	fmt.Fprintf(w, "OKAY%04x%s", len(msg), msg)
+}
+
+func writeFailure(w io.Writer, msg string) {
+	fmt.Fprintf(w, "FAIL%04x%s", len(msg), msg)
+}
+
+func (f *fakeAdb) sync(conn *fakeConn) {
+	for {
+		var hdr struct {
+			ID     [4]byte
+			Length uint32
+		}
+
+		if err := binary.Read(conn, binary.LittleEndian, &hdr); err != nil {
+			return
+		}
+
+		data := make([]byte, hdr.Length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+
+		atomic.AddInt64(&f.requests, 1)
+
+		id, path := string(hdr.ID[:]), string(data)
+		if id != "SEND" {
+			conn.release()
+		}
+
+		switch id {
+		case "STAT":
+			st := struct {
+				ID                [4]byte
+				Mode, Size, Mtime uint32
+			}{ID: [4]byte{'S', 'T', 'A', 'T'}}
+
+			if stat, err := os.Lstat(f.path(path)); err == nil {
+				st.Mode, st.Size, st.Mtime = unixMode(stat.Mode()), uint32(stat.Size()), uint32(stat.ModTime().Unix())
+			}
+
+			binary.Write(conn, binary.LittleEndian, st)
+
+		case "LST2":
+			binary.Write(conn, binary.LittleEndian, newFakeStat("LST2", f.path(path)))
+
+		case "LIST", "LIS2":
+			f.syncList(conn, id, path)
+
+		case "RECV":
+			f.syncRecv(conn, path)
+
+		case "SEND":
+			err := f.syncSend(conn, path)
+			conn.release()
+
+			if err != nil {
+				writeSyncFailure(conn, err)
+				return
+			}
+
+			conn.Write([]byte("OKAY\x00\x00\x00\x00"))
+
+		default:
+			return
+		}
+	}
+}
+
+func (f *fakeAdb) syncList(conn net.Conn, id, path string) {
+	list, _ := ioutil.ReadDir(f.path(path))
+
+	for _, entry := range list {
+		name := entry.Name()
+		full := filepath.Join(f.path(path), name)
+
+		if id == "LIST" {
+			binary.Write(conn, binary.LittleEndian, struct {
+				ID                         [4]byte
+				Mode, Size, Mtime, NameLen uint32
+			}{
+				[4]byte{'D', 'E', 'N', 'T'},
+				unixMode(entry.Mode()), uint32(entry.Size()), uint32(entry.ModTime().Unix()),
+				uint32(len(name)),
+			})
+		} else {
+			binary.Write(conn, binary.LittleEndian, syncDent{newFakeStat("DNT2", full), uint32(len(name))})
+		}
+
+		conn.Write([]byte(name))
+	}
+
+	if id == "LIST" {
+		conn.Write(append([]byte("DONE"), make([]byte, 16)...))
+		return
+	}
+
+	binary.Write(conn, binary.LittleEndian, syncDent{Stat: syncStat{ID: [4]byte{'D', 'O', 'N', 'E'}}})
+}
+
+func (f *fakeAdb) syncRecv(conn net.Conn, path string) {
+	file, err := f.open(f.path(path))
+	if err != nil {
+		writeSyncFailure(conn, err)
+		return
+	}
+	defer file.Close()
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			conn.Write([]byte("DATA"))
+			binary.Write(conn, binary.LittleEndian, uint32(n))
+			conn.Write(buf[:n])
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			writeSyncFailure(conn, err)
+			return
+		}
+	}
+
+	conn.Write([]byte("DONE\x00\x00\x00\x00"))
+}
+
+func (f *fakeAdb) syncSend(conn net.Conn, pathMode string) error {
+	sep := strings.LastIndex(pathMode, ",")
+	if sep < 0 {
+		return fmt.Errorf("%s: Invalid send request", pathMode)
+	}
+
+	perms, err := strconv.ParseUint(pathMode[sep+1:], 10, 32)
+	if err != nil {
+		return err
+	}
+
+	path := f.path(pathMode[:sep])
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(perms).Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		var hdr struct {
+			ID     [4]byte
+			Length uint32
+		}
+
+		if err := binary.Read(conn, binary.LittleEndian, &hdr); err != nil {
+			return err
+		}
+
+		switch string(hdr.ID[:]) {
+		case "DATA":
+			if _, err := io.CopyN(file, conn, int64(hdr.Length)); err != nil {
+				return err
+			}
+
+		case "DONE":
+			if err := file.Close(); err != nil {
+				return err
+			}
+
+			mtime := time.Unix(int64(hdr.Length), 0)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				return err
+			}
+
+			return os.Chmod(path, os.FileMode(perms).Perm())
+
+		default:
+			return fmt.Errorf("%s: Invalid send chunk", hdr.ID)
+		}
+	}
+}
+
+func writeSyncFailure(w io.Writer, err error) {
+	msg := syscallError(err)
+
+	w.Write([]byte("FAIL"))
+	binary.Write(w, binary.LittleEndian, uint32(len(msg)))
+	w.Write([]byte(msg))
+}
+
+func newFakeStat(id, path string) syncStat {
+	st := syncStat{}
+	copy(st.ID[:], id)
+
+	stat, err := os.Lstat(path)
+	if err != nil {
+		st.Error = uint32(syscall.ENOENT)
+		return st
+	}
+
+	st.Mode = unixMode(stat.Mode())
+	st.Size = uint64(stat.Size())
+	st.Mtime = stat.ModTime().Unix()
+	st.Atime, st.Ctime = st.Mtime, st.Mtime
+	st.Nlink = 1
+
+	return st
+}
+
+func unixMode(mode os.FileMode) uint32 {
+	perms := uint32(mode.Perm())
+
+	switch {
+	case mode.IsDir():
+		return syscall.S_IFDIR | perms
+
+	case mode&os.ModeSymlink != 0:
+		return syscall.S_IFLNK | perms
+
+	case mode&os.ModeNamedPipe != 0:
+		return syscall.S_IFIFO | perms
+	}
+
+	return syscall.S_IFREG | perms
+}
+
+func syscallError(err error) string {
+	if perr, ok := err.(*os.PathError); ok {
+		err = perr.Err
+	}
+
+	if lerr, ok := err.(*os.LinkError); ok {
+		err = lerr.Err
+	}
+
+	msg := err.Error()
+
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+func (f *fakeAdb) shell() *fakeShell {
+	return &fakeShell{device: f, cwd: "/"}
+}
+
+// run runs a command line, which is made of commands separated by
+// ";", "&&" or "||", and returns the status of the last command.
+// Errors are written to out as well, like in a terminal.
+func (s *fakeShell) run(line string, stdin io.Reader, out io.Writer) int {
+	cmds, seps, err := parseShell(line)
+	if err != nil {
+		fmt.Fprintf(out, "sh: %s\n", err)
+		return 2
+	}
+
+	for i, words := range cmds {
+		if i > 0 {
+			switch seps[i-1] {
+			case "&&":
+				if s.status != 0 {
+					continue
+				}
+
+			case "||":
+				if s.status == 0 {
+					continue
+				}
+			}
+		}
+
+		s.status = s.exec(words, stdin, out)
+	}
+
+	return s.status
+}
+
+func (s *fakeShell) exec(words []shellWord, stdin io.Reader, out io.Writer) int {
+	var args []string
+
+	errOut := out
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		text := strings.ReplaceAll(word.text, statusMarker, strconv.Itoa(s.status))
+
+		if word.quoted {
+			args = append(args, text)
+			continue
+		}
+
+		switch text {
+		case "2>&1":
+
+		case "2>/dev/null":
+			errOut = ioutil.Discard
+
+		case ">", ">>":
+			if i+1 >= len(words) {
+				fmt.Fprintln(errOut, "sh: syntax error: missing redirection target")
+				return 2
+			}
+
+			i++
+
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if text == ">>" {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+
+			file, err := os.OpenFile(s.local(words[i].text), flags, 0644)
+			if err != nil {
+				fmt.Fprintf(errOut, "sh: %s: %s\n", words[i].text, syscallError(err))
+				return 1
+			}
+			defer file.Close()
+
+			out = file
+
+		default:
+			args = append(args, text)
+		}
+	}
+
+	if len(args) > 0 && args[0] == "exec" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return 0
+	}
+
+	fn, ok := shellFuncs[args[0]]
+	if !ok {
+		fmt.Fprintf(errOut, "sh: %s: not found\n", args[0])
+		return 127
+	}
+
+	return fn(s, args[1:], stdin, out, errOut)
+}
+
+//gocyclo:ignore
+func parseShell(line string) ([][]shellWord, []string, error) {
+	var cmds [][]shellWord
+	var seps []string
+	var words []shellWord
+	var word strings.Builder
+
+	inWord, quoted := false, false
+
+	endWord := func() {
+		if inWord {
+			words = append(words, shellWord{word.String(), quoted})
+		}
+
+		word.Reset()
+		inWord, quoted = false, false
+	}
+
+	endCmd := func(sep string) {
+		endWord()
+
+		cmds = append(cmds, words)
+		seps = append(seps, sep)
+		words = nil
+	}
+
+	// The shell's process ID is only used to kill it, which is not needed.
+	dollar := func(i int) int {
+		if i+1 < len(line) {
+			switch line[i+1] {
+			case '$':
+				word.WriteString("1")
+				return i + 1
+
+			case '?':
+				word.WriteString(statusMarker)
+				return i + 1
+			}
+		}
+
+		word.WriteByte('$')
+		return i
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch c {
+		case ' ', '\t', '\n':
+			endWord()
+
+		case ';':
+			endCmd(";")
+
+		case '&', '|':
+			if i+1 < len(line) && line[i+1] == c {
+				endCmd(line[i : i+2])
+				i++
+				break
+			}
+
+			if c == '&' && inWord && strings.HasSuffix(word.String(), ">") {
+				word.WriteByte(c)
+				break
+			}
+
+			return nil, nil, fmt.Errorf("unsupported operator %q", c)
+
+		case '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated quote")
+			}
+
+			word.WriteString(line[i+1 : i+1+end])
+			inWord, quoted = true, true
+			i += end + 1
+
+		case '"':
+			inWord, quoted = true, true
+
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`", line[i+1]) >= 0:
+					i++
+					word.WriteByte(line[i])
+
+				case line[i] == '$':
+					i = dollar(i)
+
+				default:
+					word.WriteByte(line[i])
+				}
+			}
+
+			if i >= len(line) {
+				return nil, nil, fmt.Errorf("unterminated quote")
+			}
+
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+				inWord, quoted = true, true
+			}
+
+		case '$':
+			inWord = true
+			i = dollar(i)
+
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	endCmd("")
+
+	return cmds, seps[:len(seps)-1], nil
+}
+
+// abs returns the path on the device of a path relative to the working directory.
+func (s *fakeShell) abs(p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(s.cwd, p)
+	}
+
+	return filepath.Clean(p)
+}
+
+func (s *fakeShell) local(p string) string {
+	return s.device.path(s.abs(p))
+}
+
+func shellFail(errOut io.Writer, cmd, path string, err error) int {
+	fmt.Fprintf(errOut, "%s: %s: %s\n", cmd, path, syscallError(err))
+	return 1
+}
+
+// shellFlags splits the arguments of a command into its single
+// letter flags and its operands, and returns the flags which are set.
+func shellFlags(args []string, withValue string) (map[byte]string, []string) {
+	var operands []string
+
+	flags := make(map[byte]string)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			operands = append(operands, arg)
+			continue
+		}
+
+		for j := 1; j < len(arg); j++ {
+			if strings.IndexByte(withValue, arg[j]) >= 0 {
+				switch {
+				case j+1 < len(arg):
+					flags[arg[j]] = arg[j+1:]
+
+				case i+1 < len(args):
+					i++
+					flags[arg[j]] = args[i]
+				}
+
+				break
+			}
+
+			flags[arg[j]] = ""
+		}
+	}
+
+	return flags, operands
+}
+
+func shellTrue(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	return 0
+}
+
+func shellEcho(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	fmt.Fprintln(out, strings.Join(args, " "))
+	return 0
+}
+
+func shellMkdir(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	flags, operands := shellFlags(args, "m")
+	_, parents := flags['p']
+
+	status := 0
+
+	for _, path := range operands {
+		var err error
+
+		if parents {
+			err = os.MkdirAll(s.local(path), 0755)
+		} else {
+			err = os.Mkdir(s.local(path), 0755)
+		}
+
+		if err != nil {
+			status = shellFail(errOut, "mkdir", path, err)
+		}
+	}
+
+	return status
+}
+
+func shellChmod(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	_, operands := shellFlags(args, "")
+	if len(operands) < 2 {
+		fmt.Fprintln(errOut, "chmod: Needs 2 arguments")
+		return 1
+	}
+
+	mode, err := strconv.ParseUint(operands[0], 8, 32)
+	if err != nil {
+		fmt.Fprintf(errOut, "chmod: %s: Invalid mode\n", operands[0])
+		return 1
+	}
+
+	status := 0
+
+	for _, path := range operands[1:] {
+		if err := os.Chmod(s.local(path), os.FileMode(mode)); err != nil {
+			status = shellFail(errOut, "chmod", path, err)
+		}
+	}
+
+	return status
+}
+
+// target returns the local path which src is copied or moved to,
+// which is inside dst if it is a directory.
+func (s *fakeShell) target(src, dst string) string {
+	if stat, err := os.Stat(s.local(dst)); err == nil && stat.IsDir() {
+		return filepath.Join(s.local(dst), filepath.Base(src))
+	}
+
+	return s.local(dst)
+}
+
+func shellCommand(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	_, operands := shellFlags(args, "")
+
+	for _, name := range operands {
+		if _, ok := shellFuncs[name]; !ok {
+			return 1
+		}
+
+		fmt.Fprintln(out, name)
+	}
+
+	return 0
+}
+
+func shellCp(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	flags, operands := shellFlags(args, "")
+	if len(operands) != 2 {
+		fmt.Fprintln(errOut, "cp: Needs 2 arguments")
+		return 1
+	}
+
+	_, r := flags['r']
+	_, R := flags['R']
+	_, a := flags['a']
+
+	src, dst := operands[0], operands[1]
+
+	if err := copyTree(s.local(src), s.target(src, dst), r || R || a); err != nil {
+		return shellFail(errOut, "cp", src, err)
+	}
+
+	return 0
+}
+
+func copyTree(src, dst string, recursive bool) error {
+	stat, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case stat.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+
+		os.Remove(dst)
+
+		return os.Symlink(target, dst)
+
+	case stat.IsDir():
+		if !recursive {
+			return syscall.EISDIR
+		}
+
+		if err := os.MkdirAll(dst, stat.Mode().Perm()); err != nil {
+			return err
+		}
+
+		list, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range list {
+			err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), true)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, data, stat.Mode().Perm())
+}
+
+func shellMv(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	_, operands := shellFlags(args, "")
+	if len(operands) != 2 {
+		fmt.Fprintln(errOut, "mv: Needs 2 arguments")
+		return 1
+	}
+
+	src, dst := operands[0], operands[1]
+
+	if err := os.Rename(s.local(src), s.target(src, dst)); err != nil {
+		return shellFail(errOut, "mv", src, err)
+	}
+
+	return 0
+}
+
+func shellRm(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	flags, operands := shellFlags(args, "")
+	_, r := flags['r']
+	_, R := flags['R']
+	_, force := flags['f']
+
+	status := 0
+
+	for _, path := range operands {
+		local := s.local(path)
+
+		stat, err := os.Lstat(local)
+		switch {
+		case err != nil:
+			if !force {
+				status = shellFail(errOut, "rm", path, err)
+			}
+
+		case stat.IsDir() && !(r || R):
+			status = shellFail(errOut, "rm", path, syscall.EISDIR)
+
+		default:
+			if err := os.RemoveAll(local); err != nil {
+				status = shellFail(errOut, "rm", path, err)
+			}
+		}
+	}
+
+	return status
+}
+
+func shellRmdir(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	_, operands := shellFlags(args, "")
+
+	status := 0
+
+	for _, path := range operands {
+		local := s.local(path)
+
+		if stat, err := os.Lstat(local); err == nil && !stat.IsDir() {
+			status = shellFail(errOut, "rmdir", path, syscall.ENOTDIR)
+			continue
+		}
+
+		if err := syscall.Rmdir(local); err != nil {
+			status = shellFail(errOut, "rmdir", path, err)
+		}
+	}
+
+	return status
+}
+
+// shellFind supports -mindepth, -maxdepth, -type and -exec ... {} +,
+// and prints the paths it finds otherwise.
+//
+//gocyclo:ignore
+func shellFind(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	var fileType string
+	var execArgs []string
+
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	start := args[0]
+	minDepth, maxDepth := 0, -1
+
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			fmt.Fprintf(errOut, "find: %s: Needs 1 argument\n", args[i])
+			return 1
+		}
+
+		switch args[i] {
+		case "-mindepth", "-maxdepth":
+			depth, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(errOut, "find: %s: Not a number\n", args[i+1])
+				return 1
+			}
+
+			if args[i] == "-mindepth" {
+				minDepth = depth
+			} else {
+				maxDepth = depth
+			}
+
+			i++
+
+		case "-type":
+			fileType = args[i+1]
+			i++
+
+		case "-exec":
+			end := i + 1
+			for end < len(args) && args[end] != "+" && args[end] != ";" {
+				end++
+			}
+
+			if end == len(args) {
+				fmt.Fprintln(errOut, "find: -exec: Needs ; or +")
+				return 1
+			}
+
+			execArgs = args[i+1 : end]
+			i = end
+
+		default:
+			fmt.Fprintf(errOut, "find: Unknown option %s\n", args[i])
+			return 1
+		}
+	}
+
+	var found []string
+
+	status := 0
+	root := s.local(start)
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(root, p)
+
+		depth := 0
+		if rel != "." {
+			depth = strings.Count(rel, string(filepath.Separator)) + 1
+		}
+
+		if err != nil {
+			status = shellFail(errOut, "find", filepath.Join(start, rel), err)
+			return nil
+		}
+
+		if maxDepth >= 0 && depth > maxDepth {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		switch {
+		case depth < minDepth:
+		case fileType == "f" && !info.Mode().IsRegular():
+		case fileType == "d" && !info.IsDir():
+
+		default:
+			found = append(found, filepath.Join(start, rel))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return shellFail(errOut, "find", start, err)
+	}
+
+	if execArgs == nil {
+		for _, p := range found {
+			fmt.Fprintln(out, p)
+		}
+
+		return status
+	}
+
+	if len(found) == 0 {
+		return status
+	}
+
+	var cmd []string
+
+	for _, arg := range execArgs {
+		if arg == "{}" {
+			cmd = append(cmd, found...)
+		} else {
+			cmd = append(cmd, arg)
+		}
+	}
+
+	fn, ok := shellFuncs[cmd[0]]
+	if !ok {
+		fmt.Fprintf(errOut, "find: %s: No such file or directory\n", cmd[0])
+		return 1
+	}
+
+	if fn(s, cmd[1:], stdin, out, errOut) != 0 {
+		status = 1
+	}
+
+	return status
+}
+
+func shellSu(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	if len(args) != 2 || args[0] != "-c" {
+		fmt.Fprintln(errOut, "su: Only -c is supported")
+		return 1
+	}
+
+	return s.device.shell().run(args[1], stdin, out)
+}
+
+func shellStat(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	flags, operands := shellFlags(args, "c")
+	_, follow := flags['L']
+
+	format, ok := flags['c']
+	if !ok {
+		fmt.Fprintln(errOut, "stat: Only -c is supported")
+		return 1
+	}
+
+	status := 0
+
+	for _, path := range operands {
+		stat, err := os.Lstat(s.local(path))
+		if follow {
+			stat, err = os.Stat(s.local(path))
+		}
+
+		if err != nil {
+			status = shellFail(errOut, "stat", path, err)
+			continue
+		}
+
+		replacer := strings.NewReplacer(
+			"%f", strconv.FormatUint(uint64(unixMode(stat.Mode())), 16),
+			"%a", strconv.FormatUint(uint64(stat.Mode().Perm()), 8),
+			"%s", strconv.FormatInt(stat.Size(), 10),
+			"%Y", strconv.FormatInt(stat.ModTime().Unix(), 10),
+			"%n", path,
+		)
+
+		fmt.Fprintln(out, replacer.Replace(format))
+	}
+
+	return status
+}
+
+func shellCat(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	_, operands := shellFlags(args, "")
+
+	if len(operands) == 0 {
+		io.Copy(out, stdin)
+		return 0
+	}
+
+	status := 0
+
+	for _, path := range operands {
+		file, err := s.device.open(s.local(path))
+		if err != nil {
+			status = shellFail(errOut, "cat", path, err)
+			continue
+		}
+
+		io.Copy(out, file)
+		file.Close()
+	}
+
+	return status
+}
+
+// shellTar supports "tar -cf - [-C dir] path", and writes
+// the archive set for path with setArchive if there is one.
+func shellTar(s *fakeShell, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	flags, operands := shellFlags(args, "fC")
+	if _, ok := flags['c']; !ok || flags['f'] != "-" || len(operands) != 1 {
+		fmt.Fprintln(errOut, "tar: Only -cf - is supported")
+		return 1
+	}
+
+	dir := flags['C']
+	if dir == "" {
+		dir = "."
+	}
+
+	path := s.abs(filepath.Join(dir, operands[0]))
+
+	s.device.lock.Lock()
+	archive, ok := s.device.archives[path]
+	s.device.lock.Unlock()
+
+	if ok {
+		out.Write(archive.data)
+		return archive.status
+	}
+
+	root := s.local(dir)
+	writer := tar.NewWriter(out)
+
+	err := filepath.Walk(s.local(path), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		var link string
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		hdr.Name = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := writer.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(writer, file)
+
+		return err
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		return shellFail(errOut, "tar", operands[0], err)
+	}
+
+	return 0
+}
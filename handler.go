@@ -7,12 +7,12 @@ import (
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
-	adb "github.com/zach-klippenstein/goadb"
 )
 
 type selection struct {
-	path  string
-	smode ifaceMode
+	path   string
+	smode  ifaceMode
+	access deviceAccess
 }
 
 var (
@@ -20,7 +20,7 @@ var (
 	openLock       sync.Mutex
 	selectLock     sync.RWMutex
 	openFiles      map[string]struct{}
-	multiselection map[string]ifaceMode
+	multiselection map[string]selection
 )
 
 func opsHandler(selPane, auxPane *dirPane, key rune) {
@@ -74,12 +74,29 @@ func opsHandler(selPane, auxPane *dirPane, key rune) {
 			mrinput = filepath.Join(selPane.path, mrinput)
 		}
 
-		srctmp = []selection{{srcpath, selPane.mode}}
+		srctmp = []selection{{srcpath, selPane.mode, selPane.deviceAccess}}
 	}
 
 	confirmOperation(auxPane, selPane, opstmp, overwrite, srctmp)
 }
 
+func syncHandler(srcPane, dstPane *dirPane) {
+	if !srcPane.getLock() {
+		return
+	}
+	defer srcPane.setUnlock()
+
+	src, dst := srcPane.getPath(), dstPane.getPath()
+
+	if srcPane.mode == dstPane.mode && srcPane.serial == dstPane.serial &&
+		(isSubPath(src, dst) || isSubPath(dst, src)) {
+		showErrorMsg(fmt.Errorf("Cannot Sync %s to %s", src, dst), false)
+		return
+	}
+
+	showSyncConfirm(srcPane, dstPane)
+}
+
 func (p *dirPane) modeSwitchHandler() {
 	if !p.getLock() {
 		return
@@ -93,7 +110,7 @@ func (p *dirPane) modeSwitchHandler() {
 		p.path = p.dpath
 
 	case mLocal:
-		if !checkAdb() {
+		if !checkAdb(p.serial) {
 			return
 		}
 		p.mode = mAdb
@@ -104,6 +121,129 @@ func (p *dirPane) modeSwitchHandler() {
 	p.ChangeDir(false, false)
 }
 
+func (p *dirPane) rootSwitchHandler() {
+	if !p.getLock() {
+		return
+	}
+	defer p.setUnlock()
+
+	if p.mode != mAdb {
+		showErrorMsg(fmt.Errorf("Root mode is only available in ADB mode"), false)
+		return
+	}
+
+	if !p.root {
+		if err := checkRoot(p.serial); err != nil {
+			showErrorMsg(err, false)
+			return
+		}
+
+		showInfoMsg("Root mode enabled")
+	} else {
+		showInfoMsg("Root mode disabled")
+	}
+
+	p.root = !p.root
+	p.runas = ""
+
+	p.ChangeDir(false, false)
+}
+
+func preserveSwitchHandler() {
+	preserveToggle = !preserveToggle
+
+	if preserveToggle {
+		showInfoMsg("Preserving modification times and permissions")
+	} else {
+		showInfoMsg("Not preserving modification times and permissions")
+	}
+}
+
+func continueSwitchHandler() {
+	continueToggle = !continueToggle
+
+	if continueToggle {
+		showInfoMsg("Continuing jobs when files fail")
+	} else {
+		showInfoMsg("Stopping jobs at the first failed file")
+	}
+}
+
+func verifySwitchHandler() {
+	verifyToggle = !verifyToggle
+
+	if verifyToggle {
+		showInfoMsg("Verifying checksums of transferred files")
+	} else {
+		showInfoMsg("Not verifying checksums of transferred files")
+	}
+}
+
+func (p *dirPane) runAsSwitchHandler(pkg string) {
+	if !p.getLock() {
+		return
+	}
+	defer p.setUnlock()
+
+	if pkg == "" {
+		if p.runas == "" {
+			return
+		}
+
+		showInfoMsg("Exiting run-as mode for " + p.runas)
+
+		p.runas = ""
+		p.path = initAPath
+		p.ChangeDir(false, false)
+
+		return
+	}
+
+	if !checkAdb(p.serial) {
+		return
+	}
+
+	if err := checkRunAs(p.serial, pkg); err != nil {
+		showErrorMsg(err, false)
+		return
+	}
+
+	if p.mode == mLocal {
+		p.mode = mAdb
+		p.dpath = p.path
+	}
+
+	p.root = false
+	p.runas = pkg
+	p.path = "/data/data/" + pkg
+
+	p.ChangeDir(false, false)
+}
+
+func (p *dirPane) deviceSwitchHandler(serial string) {
+	if !p.getLock() {
+		return
+	}
+	defer p.setUnlock()
+
+	if !checkAdb(serial) {
+		return
+	}
+
+	if p.mode == mLocal {
+		p.mode = mAdb
+		p.dpath = p.path
+		p.path = p.apath
+	}
+
+	p.serial = serial
+	p.root = false
+	p.runas = ""
+	p.offline = false
+
+	p.ChangeDir(false, false)
+}
+
 func (p *dirPane) multiSelectHandler(all, inverse bool, totalrows int) {
 	if !p.getLock() {
 		return
@@ -118,7 +258,7 @@ func (p *dirPane) multiSelectHandler(all, inverse bool, totalrows int) {
 	mselinv := !all && inverse
 
 	for i := 0; i < totalrows; i++ {
-		var dir *adb.DirEntry
+		var dir *dirEntry
 
 		if mselone {
 			i, _ = p.table.GetSelection()
@@ -136,7 +276,7 @@ func (p *dirPane) multiSelectHandler(all, inverse bool, totalrows int) {
 
 		checksel := false
 
-		dir = ref.(*adb.DirEntry)
+		dir = ref.(*dirEntry)
 		fullpath := filepath.Join(p.path, dir.Name)
 
 		if mselone || mselinv {
@@ -144,7 +284,7 @@ func (p *dirPane) multiSelectHandler(all, inverse bool, totalrows int) {
 		}
 
 		if !checksel {
-			addmsel(fullpath, p.mode)
+			addmsel(fullpath, p.mode, p.deviceAccess)
 		}
 
 		p.updateDirPane(i, !checksel, dir)
@@ -180,7 +320,7 @@ func (p *dirPane) openFileHandler() {
 		&dirPane{path: tpath, mode: mLocal},
 		opCopy,
 		false,
-		[]selection{{fpath, p.mode}},
+		[]selection{{fpath, p.mode, p.deviceAccess}},
 	)
 	if err != nil {
 		showErrorMsg(
@@ -227,7 +367,7 @@ func (p *dirPane) openFileHandler() {
 		}
 	}()
 
-	cmd, err := execCmd(fmt.Sprintf("xdg-open '%s'", tmpdst), "Background", "Local")
+	cmd, err := execCmd(shellJoin("xdg-open", tmpdst), "Background", "Local")
 	if err != nil {
 		showErrorMsg(err, false)
 		return
@@ -243,10 +383,10 @@ func (p *dirPane) openFileHandler() {
 	case <-modify:
 		_, err = startOperation(
 			p,
-			&dirPane{path: fpath, mode: p.mode},
+			&dirPane{path: fpath, mode: p.mode, deviceAccess: p.deviceAccess},
 			opCopy,
 			true,
-			[]selection{{tmpdst, mLocal}},
+			[]selection{{tmpdst, mLocal, deviceAccess{}}},
 		)
 
 		if err != nil {
@@ -308,11 +448,11 @@ func delmsel(fullpath string) {
 	delete(multiselection, fullpath)
 }
 
-func addmsel(fullpath string, mode ifaceMode) {
+func addmsel(fullpath string, mode ifaceMode, access deviceAccess) {
 	selectLock.Lock()
 	defer selectLock.Unlock()
 
-	multiselection[fullpath] = mode
+	multiselection[fullpath] = selection{fullpath, mode, access}
 }
 
 func checkmsel(fullpath string) bool {
@@ -330,8 +470,8 @@ func getselection() []selection {
 
 	var s []selection
 
-	for path, smode := range multiselection {
-		s = append(s, selection{path, smode})
+	for _, sel := range multiselection {
+		s = append(s, sel)
 	}
 
 	return s
@@ -12,7 +12,6 @@ import (
 	"sync"
 
 	"github.com/gdamore/tcell/v2"
-	adb "github.com/zach-klippenstein/goadb"
 	"golang.org/x/term"
 )
 
@@ -85,17 +84,10 @@ func (p *dirPane) isDir(testPath string) bool {
 		return false
 	}
 
-	name := p.entry.Name
 	mode := p.entry.Mode
 
 	if mode&os.ModeSymlink != 0 {
-		switch p.mode {
-		case mAdb:
-			return isAdbSymDir(testPath, name)
-
-		case mLocal:
-			return isLocalSymDir(testPath, name)
-		}
+		return p.entry.LinkDir
 	}
 
 	if !mode.IsDir() {
@@ -128,15 +120,15 @@ func (p *dirPane) localListDir(testPath string, autocomplete bool) ([]string, bo
 	}
 
 	for _, entry := range list {
-		var d adb.DirEntry
-
 		name := entry.Name()
 
 		if p.getHidden() && strings.HasPrefix(name, ".") {
 			continue
 		}
 
-		if entry.IsDir() || isLocalSymDir(testPath, name) {
+		symdir := isLocalSymDir(testPath, name)
+
+		if entry.IsDir() || symdir {
 			dlist = append(dlist, filepath.Join(testPath, name))
 		}
 
@@ -144,17 +136,28 @@ func (p *dirPane) localListDir(testPath string, autocomplete bool) ([]string, bo
 			continue
 		}
 
-		d.Name = name
-		d.Mode = entry.Mode()
-		d.Size = int32(entry.Size())
-		d.ModifiedAt = entry.ModTime()
+		d := newLocalEntry(entry)
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			d.LinkDir = symdir
+			d.LinkTarget, _ = os.Readlink(filepath.Join(testPath, name))
+		}
 
-		p.pathList = append(p.pathList, &d)
+		p.pathList = append(p.pathList, d)
 	}
 
 	return dlist, true
 }
 
+func newLocalEntry(entry os.FileInfo) *dirEntry {
+	return &dirEntry{
+		Name:       entry.Name(),
+		Mode:       entry.Mode(),
+		Size:       entry.Size(),
+		ModifiedAt: entry.ModTime(),
+	}
+}
+
 func (p *dirPane) doChangeDir(cdFwd bool, cdBack bool, tpath ...string) {
 	var listed bool
 	var testPath, prevDir string
@@ -238,7 +241,7 @@ func resizeDirEntries(width int) {
 						continue
 					}
 
-					cell.SetMaxWidth(width - 40)
+					cell.SetMaxWidth(width - 50)
 				}
 
 				pane.setPaneTitle()
@@ -335,22 +338,45 @@ func (o *operation) localOps(src, dst string) error {
 	return err
 }
 
-func getListEntry(dir *adb.DirEntry) []string {
+func getListEntry(dir *dirEntry) []string {
 	perms := strings.ToLower(dir.Mode.String())
 
 	if len(perms) > 10 {
 		perms = perms[1:]
 	}
 
+	size := "-"
+	if !dir.Mode.IsDir() {
+		size = getSizeString(dir.Size)
+	}
+
 	entry := []string{
 		dir.Name,
 		perms,
+		size,
 		dir.ModifiedAt.Format("02 Jan 2006 03:04 PM"),
 	}
 
 	return entry
 }
 
+func getSizeString(size int64) string {
+	const unit = 1024
+	const suffixes = "KMGTPE"
+
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), suffixes[exp])
+}
+
 func setEntryColor(col int, sel bool, perms string) (tcell.Color, tcell.AttrMask) {
 	if col > 0 {
 		switch {
@@ -403,7 +429,9 @@ func execCmd(cmdtext, emode, imode string) (*exec.Cmd, error) {
 	}
 
 	if imode == "Adb" {
-		_, err := getAdb()
+		serial := prevPane.serial
+
+		_, err := getAdb(serial)
 		if err != nil {
 			if cmdtext == "" {
 				showErrorMsg(err, false)
@@ -412,7 +440,12 @@ func execCmd(cmdtext, emode, imode string) (*exec.Cmd, error) {
 			return nil, err
 		}
 
-		cmdtext = "adb shell " + cmdtext
+		adbcmd := "adb"
+		for _, arg := range adbCmdArgs(serial, "shell") {
+			adbcmd += " " + shellQuote(arg)
+		}
+
+		cmdtext = adbcmd + " " + cmdtext
 	}
 
 	if cmdtext == "" {
@@ -456,7 +489,7 @@ func execCmd(cmdtext, emode, imode string) (*exec.Cmd, error) {
 	return cmd, err
 }
 
-func (p *dirPane) sortDirList(list []*adb.DirEntry) {
+func (p *dirPane) sortDirList(list []*dirEntry) {
 	sortType, arrangeBy := p.getSortMethod()
 
 	sort.Slice(list, func(i, j int) bool {
@@ -15,6 +15,7 @@ var (
 	initLPath   string
 	initSelPath string
 	initAuxPath string
+	initSerial  string
 	initSelMode ifaceMode
 	initAuxMode ifaceMode
 )
@@ -26,8 +27,55 @@ func main() {
 	cmdLPath := kingpin.Flag("local", "Specify the local path to start in").
 		Default("/home").String()
 
+	cmdSerial := kingpin.Flag("serial", "Specify the serial of the ADB device to use").
+		String()
+
+	cmdConnect := kingpin.Flag("connect", "Connect to a wireless ADB device (host:port)").
+		Strings()
+
+	cmdPreserve := kingpin.Flag("preserve", "Preserve modification times and permissions of copied files").
+		Default("true").Bool()
+
+	cmdVerify := kingpin.Flag("verify", "Verify checksums of files transferred to or from devices").
+		Bool()
+
+	cmdContinue := kingpin.Flag("continue-on-error", "Continue jobs when files fail, and list the failed files at the end").
+		Bool()
+
+	cmdDupFormat := kingpin.Flag("duplicate-format", "Name duplicates as 'name (1).ext' (number) or 'name_copy.ext' (copy)").
+		Default("number").Enum("number", "copy")
+
+	cmdTar := kingpin.Flag("tar", "Transfer directory trees as tar streams (auto, always, never)").
+		Default("auto").Enum("auto", "always", "never")
+
+	cmdJobs := kingpin.Flag("jobs", "Number of operations which can run at the same time on each device, 0 for no limit").
+		Default("1").Int()
+
+	cmdAdbHost := kingpin.Flag("adb-host", "Specify the host of the ADB server").
+		Envar("ANDROID_ADB_SERVER_ADDRESS").String()
+
+	cmdAdbPort := kingpin.Flag("adb-port", "Specify the port of the ADB server").
+		Envar("ANDROID_ADB_SERVER_PORT").Int()
+
 	kingpin.Parse()
 
+	if err := setAdbServer(*cmdAdbHost, *cmdAdbPort); err != nil {
+		fmt.Printf("adbtuifm: %s\n", err.Error())
+		return
+	}
+
+	for _, address := range *cmdConnect {
+		endpoint, err := connectDevice(address)
+		if err != nil {
+			fmt.Printf("adbtuifm: %s: %s\n", address, err.Error())
+			return
+		}
+
+		if *cmdSerial == "" {
+			*cmdSerial = endpoint
+		}
+	}
+
 	_, err := os.Lstat(*cmdLPath)
 	if err != nil {
 		fmt.Printf("adbtuifm: %s: Invalid local path\n", *cmdLPath)
@@ -37,7 +85,12 @@ func main() {
 	initSelMode = mLocal
 	initSelPath, _ = filepath.Abs(*cmdLPath)
 
-	device, err := getAdb()
+	initSerial = *cmdSerial
+	if initSerial == "" {
+		initSerial = getDefaultSerial()
+	}
+
+	device, err := getAdb(initSerial)
 	if device != nil {
 		_, err := device.Stat(*cmdAPath)
 		if err != nil {
@@ -53,12 +106,18 @@ func main() {
 	}
 
 	initAPath = *cmdAPath
+	preserveToggle = *cmdPreserve
+	verifyToggle = *cmdVerify
+	continueToggle = *cmdContinue
+	dupFormat = *cmdDupFormat
+	tarMode = *cmdTar
+	maxJobs = *cmdJobs
 	initLPath, _ = filepath.Abs(*cmdLPath)
 
 	jobNum = 0
 	selected = false
 	openFiles = make(map[string]struct{})
-	multiselection = make(map[string]ifaceMode)
+	multiselection = make(map[string]selection)
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(
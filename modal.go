@@ -17,6 +17,11 @@ type popupModal struct {
 	statusFlex *tview.Flex
 }
 
+type selectItem struct {
+	text string
+	ref  string
+}
+
 var popup popupModal
 
 //gocyclo:ignore
@@ -215,6 +220,320 @@ func changeDirSelect(pane *dirPane, input *tview.InputField) {
 	autocompletefunc(pane.getPath(), false)
 }
 
+func deviceSelect(pane *dirPane, input *tview.InputField) bool {
+	var items []selectItem
+
+	devices, err := getDevices()
+	if err != nil {
+		showErrorMsg(err, false)
+		return false
+	}
+
+	for _, dev := range devices {
+		items = append(items, selectItem{dev.String(), dev.serial})
+	}
+
+	listSelect(pane, input, "devmodal", items, func(serial string) {
+		showInfoMsg("Switching to device " + serial)
+		pane.deviceSwitchHandler(serial)
+	})
+
+	return true
+}
+
+func packageSelect(pane *dirPane, input *tview.InputField) bool {
+	var items []selectItem
+
+	if pane.mode != mAdb && !checkAdb(pane.serial) {
+		return false
+	}
+
+	packages, err := getPackages(pane.serial)
+	if err != nil {
+		showErrorMsg(err, false)
+		return false
+	}
+
+	if pane.runas != "" {
+		items = append(items, selectItem{"Exit run-as mode (" + pane.runas + ")", ""})
+	}
+
+	for _, pkg := range packages {
+		items = append(items, selectItem{pkg, pkg})
+	}
+
+	listSelect(pane, input, "pkgmodal", items, func(pkg string) {
+		if pkg != "" {
+			showInfoMsg("Switching to run-as mode for " + pkg)
+		}
+
+		pane.runAsSwitchHandler(pkg)
+	})
+
+	return true
+}
+
+func listSelect(pane *dirPane, input *tview.InputField, name string, items []selectItem, selectFunc func(ref string)) {
+	listtable := tview.NewTable()
+
+	flex := tview.NewFlex().
+		AddItem(listtable, 0, 10, false).
+		SetDirection(tview.FlexRow)
+
+	exit := func() {
+		popupStatus(false)
+		pages.SwitchToPage("main")
+		statuspgs.SwitchToPage("statusmsg")
+		app.SetFocus(pane.table)
+	}
+
+	reload := func(current string) {
+		var row int
+
+		listtable.Clear()
+
+		for _, item := range items {
+			if !strings.Contains(
+				strings.ToLower(item.text),
+				strings.ToLower(current),
+			) {
+				continue
+			}
+
+			cell := tview.NewTableCell("[::b]" + tview.Escape(item.text))
+
+			cell.SetReference(item.ref)
+			listtable.SetCell(row, 0, cell.SetTextColor(tcell.ColorSteelBlue))
+
+			row++
+		}
+
+		if row == 0 {
+			pages.HidePage(name)
+		} else {
+			if pg, _ := pages.GetFrontPage(); pg != name {
+				pages.SwitchToPage(name).ShowPage("main")
+			}
+
+			resizemodal()
+		}
+
+		app.SetFocus(input)
+
+		listtable.Select(0, 0)
+		listtable.ScrollToBeginning()
+	}
+
+	input.SetChangedFunc(func(text string) {
+		reload(text)
+	})
+
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			row, _ := listtable.GetSelection()
+
+			cell := listtable.GetCell(row, 0)
+			if ref := cell.GetReference(); ref != nil {
+				selectFunc(ref.(string))
+			}
+
+			fallthrough
+
+		case tcell.KeyEscape:
+			exit()
+
+		case tcell.KeyDown, tcell.KeyUp, tcell.KeyPgDn, tcell.KeyPgUp:
+			listtable.InputHandler()(event, nil)
+			return nil
+		}
+
+		return event
+	})
+
+	listtable.SetSelectionChangedFunc(func(row, _ int) {
+		if row < 0 {
+			return
+		}
+
+		cell := listtable.GetCell(row, 0)
+		if cell == nil {
+			return
+		}
+
+		listtable.SetSelectedStyle(tcell.Style{}.
+			Bold(true).
+			Underline(true).
+			Background(cell.Color).
+			Foreground(tcell.ColorLightGrey))
+	})
+
+	listtable.Select(0, 0)
+	listtable.SetSelectable(true, false)
+	listtable.SetBackgroundColor(tcell.ColorLightGrey)
+
+	pages.AddPage(name, statusmodal(flex, listtable), true, false).ShowPage("main")
+
+	reload("")
+}
+
+func syncPlanSelect(input *tview.InputField, plan *syncPlan, runFunc func()) {
+	plantable := tview.NewTable()
+
+	flex := tview.NewFlex().
+		AddItem(plantable, 0, 10, false).
+		SetDirection(tview.FlexRow)
+
+	label := func() {
+		input.SetLabel("[::b]Sync plan (" + plan.String() + "): ")
+	}
+
+	exit := func() {
+		popupStatus(false)
+		pages.SwitchToPage("main")
+		statuspgs.SwitchToPage("statusmsg")
+		app.SetFocus(prevPane.table)
+	}
+
+	setcell := func(row int, item *syncItem) {
+		color := tcell.ColorSteelBlue
+
+		if !item.skip {
+			switch item.action {
+			case syncAdd:
+				color = tcell.ColorGreen
+
+			case syncUpdate:
+				color = tcell.ColorDarkOrange
+
+			case syncDelete:
+				color = tcell.ColorOrangeRed
+			}
+		}
+
+		cell := tview.NewTableCell("[::b]" + tview.Escape(item.String()))
+
+		cell.SetReference(item)
+		plantable.SetCell(row, 0, cell.SetTextColor(color))
+	}
+
+	reload := func(current string) {
+		var row int
+
+		plantable.Clear()
+
+		for _, item := range plan.items {
+			if !strings.Contains(
+				strings.ToLower(item.path),
+				strings.ToLower(current),
+			) {
+				continue
+			}
+
+			setcell(row, item)
+			row++
+		}
+
+		if row == 0 {
+			pages.HidePage("syncmodal")
+		} else {
+			if pg, _ := pages.GetFrontPage(); pg != "syncmodal" {
+				pages.SwitchToPage("syncmodal").ShowPage("main")
+			}
+
+			resizemodal()
+		}
+
+		app.SetFocus(input)
+
+		plantable.Select(0, 0)
+		plantable.ScrollToBeginning()
+	}
+
+	toggle := func() {
+		row, _ := plantable.GetSelection()
+
+		cell := plantable.GetCell(row, 0)
+		if cell == nil || cell.GetReference() == nil {
+			return
+		}
+
+		item := cell.GetReference().(*syncItem)
+		plan.setSkip(item, !item.skip)
+
+		for i := 0; i < plantable.GetRowCount(); i++ {
+			setcell(i, plantable.GetCell(i, 0).GetReference().(*syncItem))
+		}
+
+		label()
+
+		if row+1 < plantable.GetRowCount() {
+			plantable.Select(row+1, 0)
+		}
+	}
+
+	input.SetChangedFunc(func(text string) {
+		reload(text)
+	})
+
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			exit()
+
+			if add, update, del := plan.counts(); add+update+del == 0 {
+				showInfoMsg("Nothing to sync")
+				return nil
+			}
+
+			runFunc()
+
+			return nil
+
+		case tcell.KeyEscape:
+			exit()
+			return nil
+
+		case tcell.KeyDown, tcell.KeyUp, tcell.KeyPgDn, tcell.KeyPgUp:
+			plantable.InputHandler()(event, nil)
+			return nil
+		}
+
+		if event.Modifiers() == tcell.ModAlt && event.Rune() == ' ' {
+			toggle()
+			return nil
+		}
+
+		return event
+	})
+
+	plantable.SetSelectionChangedFunc(func(row, _ int) {
+		if row < 0 {
+			return
+		}
+
+		cell := plantable.GetCell(row, 0)
+		if cell == nil {
+			return
+		}
+
+		plantable.SetSelectedStyle(tcell.Style{}.
+			Bold(true).
+			Underline(true).
+			Background(cell.Color).
+			Foreground(tcell.ColorLightGrey))
+	})
+
+	plantable.Select(0, 0)
+	plantable.SetSelectable(true, false)
+	plantable.SetBackgroundColor(tcell.ColorLightGrey)
+
+	pages.AddPage("syncmodal", statusmodal(flex, plantable), true, false).ShowPage("main")
+
+	label()
+	reload("")
+}
+
 //gocyclo:ignore
 func editSelections(input, sinput *tview.InputField) *tview.InputField {
 	if len(multiselection) == 0 {
@@ -5,17 +5,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/darkhz/tview"
+	"github.com/gdamore/tcell/v2"
 )
 
 type operation struct {
 	id         int
+	srcDev     deviceAccess
+	dstDev     deviceAccess
 	currFile   int
 	totalFile  int
 	currBytes  int64
 	totalBytes int64
+	preserve   bool
+	verify     bool
+	done       bool
+	resume     bool
+	keepGoing  bool
+	err        error
+	errors     []fileError
+	failed     []transferItem
+	items      []transferItem
+	pending    []selection
+	created    map[string]struct{}
+	resolved   map[string]string
+	dstDir     string
+	dstMode    ifaceMode
+	conflict   conflictMode
+	stats      jobStats
+	devices    []string
+	queueDesc  string
+	started    chan struct{}
+	acquired   bool
+	pause      chan struct{}
+	reserved   []string
+	plan       *syncPlan
 	opmode     opsMode
 	transfer   transferMode
 	progress   progressMode
@@ -37,8 +66,38 @@ const (
 	adbToLocal
 	localToAdb
 	localToLocal
+	deviceToDevice
 )
 
+type transferItem struct {
+	src      string
+	dst      string
+	access   deviceAccess
+	transfer transferMode
+	resume   bool
+}
+
+type fileError struct {
+	item transferItem
+	err  error
+}
+
+type conflictAction int
+
+const (
+	conflictAsk conflictAction = iota
+	conflictOverwrite
+	conflictSkip
+	conflictRename
+	conflictNewer
+	conflictLarger
+)
+
+type conflictMode struct {
+	action conflictAction
+	all    bool
+}
+
 type opsMode int
 
 const (
@@ -47,6 +106,7 @@ const (
 	opMkdir
 	opRename
 	opDelete
+	opSync
 )
 
 func (m opsMode) String() string {
@@ -56,6 +116,7 @@ func (m opsMode) String() string {
 		"Mkdir",
 		"Rename",
 		"Delete",
+		"Sync",
 	}
 
 	return opstr[m]
@@ -67,7 +128,7 @@ func opString(mode string) string {
 		mode = mode[0 : len(mode)-1]
 		fallthrough
 
-	case "Copy":
+	case "Copy", "Sync":
 		mode += "ing"
 
 	default:
@@ -82,6 +143,13 @@ var (
 
 	opPaths    []string
 	opPathLock sync.Mutex
+
+	conflictLock sync.Mutex
+
+	dupFormat     string
+	dupNumber     = regexp.MustCompile(`^(.+) \(([0-9]+)\)$`)
+	reservedPaths = make(map[string]struct{})
+	reserveLock   sync.Mutex
 )
 
 func newOperation(opmode opsMode) operation {
@@ -91,10 +159,15 @@ func newOperation(opmode opsMode) operation {
 	return operation{
 		id:         jobNum,
 		opmode:     opmode,
+		preserve:   preserveToggle,
+		verify:     verifyToggle,
+		keepGoing:  continueToggle,
 		ctx:        ctx,
 		cancel:     cancel,
 		transfer:   transfer,
 		totalBytes: -1,
+		created:    make(map[string]struct{}),
+		resolved:   make(map[string]string),
 	}
 }
 
@@ -105,13 +178,22 @@ func startOperation(srcPane, dstPane *dirPane, opmode opsMode, overwrite bool, m
 	total := len(mselect)
 
 	op := newOperation(opmode)
+	if overwrite {
+		op.conflict = conflictMode{conflictOverwrite, true}
+	}
 
-	op.opSetStatus(opInProgress, nil)
+	err = op.startJob(queueDesc(&op, dstPane, mselect), jobDevices(dstPane, mselect)...)
 
 	for sel, msel := range mselect {
+		if err != nil {
+			break
+		}
+
 		src = msel.path
 		dpath := dstPane.getPath()
 
+		op.pending = mselect[sel:]
+
 		if opmode == opRename {
 			dst = mrinput
 		} else {
@@ -127,38 +209,32 @@ func startOperation(srcPane, dstPane *dirPane, opmode opsMode, overwrite bool, m
 			break
 		}
 
+		op.srcDev = msel.access
+		op.dstDev = dstPane.deviceAccess
+		op.dstDir, op.dstMode = dpath, dstPane.mode
+		op.transfer = transfermode(opmode, msel.smode, dstPane.mode, op.srcDev.serial, op.dstDev.serial)
+
 		if opmode == opCopy && !overwrite {
-			dst, err = altPath(src, dst, dstPane.mode)
+			var target string
+
+			target, err = op.resolveConflict(src, dst, true)
 			if err != nil {
 				break
+			} else if target == "" {
+				continue
 			}
+
+			dst = target
 		}
 
 		if err = isSamePath(src, dst, opmode); err != nil {
 			break
 		}
 
-		op.transfer = transfermode(opmode, msel.smode, dstPane.mode)
-
-		if err = op.setNewProgress(src, dst, sel, total); err != nil {
-			break
-		}
+		op.pending = mselect[sel+1:]
 
-		if err = addOpsPath(src, dst); err != nil {
-			break
-		}
-
-		switch op.transfer {
-		case localToLocal:
-			err = op.localOps(src, dst)
-
-		default:
-			err = op.adbOps(src, dst)
-		}
-
-		rmOpsPath(src, dst)
-
-		if err != nil {
+		item := transferItem{src: src, dst: dst, access: msel.access, transfer: op.transfer}
+		if err = op.skipError(src, dst, op.runItem(item, sel, total)); err != nil {
 			break
 		}
 	}
@@ -169,14 +245,83 @@ func startOperation(srcPane, dstPane *dirPane, opmode opsMode, overwrite bool, m
 	if dstPane.getPath() == reloadpath {
 		dstPane.ChangeDir(false, false)
 	}
-	if srcPane.getPath() == reloadpath && srcPane.mode == dstPane.mode {
+	if srcPane.getPath() == reloadpath && srcPane.mode == dstPane.mode &&
+		srcPane.serial == dstPane.serial {
+		srcPane.ChangeDir(false, false)
+	} else if opmode == opMove && srcPane.getPath() == trimPath(src, true) {
 		srcPane.ChangeDir(false, false)
 	}
 
 	return dst, err
 }
 
-func transfermode(opmode opsMode, srcMode, dstMode ifaceMode) transferMode {
+func queueDesc(op *operation, dstPane *dirPane, mselect []selection) string {
+	if mselect == nil {
+		return ""
+	}
+
+	src := mselect[0].path
+	desc := op.describe(src, filepath.Join(dstPane.getPath(), filepath.Base(src)))
+
+	if len(mselect) > 1 {
+		desc += fmt.Sprintf(" (and %d more)", len(mselect)-1)
+	}
+
+	return desc
+}
+
+func jobDevices(dstPane *dirPane, mselect []selection) []string {
+	var devices []string
+
+	for _, msel := range mselect {
+		if msel.smode == mAdb {
+			devices = append(devices, msel.access.serial)
+		}
+	}
+
+	if dstPane.mode == mAdb {
+		devices = append(devices, dstPane.serial)
+	}
+
+	return devices
+}
+
+func (o *operation) runItem(item transferItem, sel, total int) error {
+	o.srcDev = item.access
+	o.transfer = item.transfer
+	o.resume = item.resume
+
+	o.items = append(o.items, item)
+
+	if err := o.setNewProgress(item.src, item.dst, sel, total); err != nil {
+		return err
+	}
+
+	if err := addOpsPath(item.src, item.dst); err != nil {
+		return err
+	}
+	defer rmOpsPath(item.src, item.dst)
+
+	if o.transfer == localToLocal {
+		return o.localOps(item.src, item.dst)
+	}
+
+	return o.adbOps(item.src, item.dst)
+}
+
+func (o *operation) byteProgress() bool {
+	switch o.opmode {
+	case opCopy, opSync:
+		return true
+
+	case opMove:
+		return o.transfer == adbToLocal || o.transfer == localToAdb
+	}
+
+	return false
+}
+
+func transfermode(opmode opsMode, srcMode, dstMode ifaceMode, srcSerial, dstSerial string) transferMode {
 	switch opmode {
 	case opDelete, opRename, opMkdir:
 		switch srcMode {
@@ -196,6 +341,10 @@ func transfermode(opmode opsMode, srcMode, dstMode ifaceMode) transferMode {
 			return adbToLocal
 
 		case srcMode == mAdb && dstMode == mAdb:
+			if srcSerial != dstSerial {
+				return deviceToDevice
+			}
+
 			return adbToAdb
 		}
 	}
@@ -203,10 +352,7 @@ func transfermode(opmode opsMode, srcMode, dstMode ifaceMode) transferMode {
 	return localToLocal
 }
 
-func altPath(src, dst string, iface ifaceMode) (string, error) {
-	var try int
-	var existerr error
-
+func (o *operation) altPath(src, dst string, dir bool) (string, error) {
 	rel, err := filepath.Rel(src, dst)
 	if err != nil {
 		return dst, err
@@ -216,38 +362,239 @@ func altPath(src, dst string, iface ifaceMode) (string, error) {
 		return dst, fmt.Errorf("Cannot Copy %s to %s", src, dst)
 	}
 
-	for {
-		switch iface {
-		case mAdb:
-			device, err := getAdb()
-			if err != nil {
-				return dst, err
-			}
+	local := o.transfer == adbToLocal || o.transfer == localToLocal
 
-			_, existerr = device.Stat(dst)
+	var device *adbDevice
 
-		case mLocal:
-			_, existerr = os.Lstat(dst)
+	if !local {
+		device, err = getDevice(o.dstDev)
+		if err != nil {
+			return dst, err
 		}
+	}
 
-		if existerr != nil {
-			break
+	name, ext := filepath.Base(dst), ""
+	if !dir {
+		name, ext = splitExt(name)
+	}
+
+	for try := 1; ; try++ {
+		var existerr error
+
+		path := filepath.Join(filepath.Dir(dst), dupName(name, ext, try))
+
+		key := path
+		if !local {
+			key = "adb:" + o.dstDev.serial + ":" + path
 		}
 
-		if dst[len(dst)-1:] != "_" && try == 0 {
-			dst = dst + "_"
+		if !reservePath(key) {
 			continue
 		}
 
-		dst = strings.TrimRightFunc(dst, func(r rune) bool {
-			return r < 'A' || r > 'z'
-		})
+		if local {
+			_, existerr = os.Lstat(path)
+		} else {
+			_, existerr = device.stat(path)
+		}
+
+		if existerr != nil {
+			o.reserved = append(o.reserved, key)
+			return path, nil
+		}
+
+		releasePaths(key)
+	}
+}
+
+func dupName(name, ext string, n int) string {
+	switch dupFormat {
+	case "copy":
+		if n == 1 {
+			return name + "_copy" + ext
+		}
+
+		return fmt.Sprintf("%s_copy%d%s", name, n, ext)
+	}
+
+	// Copying "IMG (1).jpg" results in "IMG (2).jpg", not "IMG (1) (1).jpg".
+	if m := dupNumber.FindStringSubmatch(name); m != nil {
+		base, num := m[1], m[2]
+
+		if start, err := strconv.Atoi(num); err == nil {
+			name, n = base, start+n
+		}
+	}
+
+	return fmt.Sprintf("%s (%d)%s", name, n, ext)
+}
+
+func splitExt(name string) (string, string) {
+	ext := filepath.Ext(name)
+	if ext == name || ext == "" {
+		return name, ""
+	}
+
+	base := strings.TrimSuffix(name, ext)
+	if tar := filepath.Ext(base); tar == ".tar" && tar != base {
+		base = strings.TrimSuffix(base, tar)
+		ext = tar + ext
+	}
+
+	return base, ext
+}
+
+func reservePath(key string) bool {
+	reserveLock.Lock()
+	defer reserveLock.Unlock()
+
+	if _, ok := reservedPaths[key]; ok {
+		return false
+	}
+
+	reservedPaths[key] = struct{}{}
+
+	return true
+}
+
+func releasePaths(keys ...string) {
+	reserveLock.Lock()
+	defer reserveLock.Unlock()
+
+	for _, key := range keys {
+		delete(reservedPaths, key)
+	}
+}
+
+//gocyclo:ignore
+func (o *operation) resolveConflict(src, dst string, top bool) (string, error) {
+	if o.opmode != opCopy || (o.conflict.all && o.conflict.action == conflictOverwrite) {
+		return dst, nil
+	}
+
+	// A resumed job keeps the files it wrote and the
+	// choices it made when it was interrupted.
+	if _, ok := o.created[dst]; ok {
+		return dst, nil
+	}
+
+	dstEntry, err := o.statPath(dst, false)
+	if err != nil {
+		return dst, nil
+	}
+
+	srcEntry, err := o.statPath(src, true)
+	if err != nil {
+		return "", err
+	}
+
+	target, ok := o.resolved[dst]
+	if ok {
+		if target == "" && !top {
+			o.skipBytes(srcEntry.Size)
+			o.updatePb()
+		}
+
+		return target, nil
+	}
+
+	merge := srcEntry.Mode.IsDir() && dstEntry.Mode.IsDir()
+
+	if !o.conflict.all {
+		mode, err := o.askConflict(srcEntry, dstEntry, dst)
+		if err != nil {
+			return "", err
+		}
+
+		o.conflict = mode
+	}
+
+	keep := true
+
+	switch o.conflict.action {
+	case conflictSkip:
+		keep = false
+
+	case conflictRename:
+		target, err := o.altPath(src, dst, srcEntry.Mode.IsDir())
+		if err == nil {
+			o.resolved[dst] = target
+		}
+
+		return target, err
+
+	case conflictNewer:
+		keep = merge || srcEntry.ModifiedAt.After(dstEntry.ModifiedAt)
+
+	case conflictLarger:
+		keep = merge || srcEntry.Size > dstEntry.Size
+	}
+
+	if keep {
+		o.resolved[dst] = dst
+		return dst, nil
+	}
+
+	o.resolved[dst] = ""
+
+	if !top {
+		o.skipBytes(srcEntry.Size)
+		o.updatePb()
+	}
+
+	return "", nil
+}
+
+func (o *operation) askConflict(src, dst *dirEntry, path string) (conflictMode, error) {
+	conflictLock.Lock()
+	defer conflictLock.Unlock()
+
+	reply := make(chan conflictMode, 1)
+
+	msg := fmt.Sprintf(
+		"'%s' exists (source: %s, %s / destination: %s, %s)",
+		filepath.Base(path),
+		getSizeString(src.Size), src.ModifiedAt.Format("02 Jan 2006 03:04 PM"),
+		getSizeString(dst.Size), dst.ModifiedAt.Format("02 Jan 2006 03:04 PM"),
+	)
+
+	app.QueueUpdateDraw(func() {
+		showConflictInput(o.ctx, msg, o.cancel, reply)
+	})
+
+	select {
+	case <-o.ctx.Done():
+		return conflictMode{}, o.ctx.Err()
+
+	case mode := <-reply:
+		return mode, nil
+	}
+}
+
+func (o *operation) statPath(path string, src bool) (*dirEntry, error) {
+	access := o.dstDev
+	local := o.transfer == adbToLocal || o.transfer == localToLocal
+
+	if src {
+		access = o.srcDev
+		local = o.transfer == localToAdb || o.transfer == localToLocal
+	}
+
+	if local {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
 
-		dst += strconv.Itoa(try)
-		try++
+		return newLocalEntry(info), nil
 	}
 
-	return dst, nil
+	device, err := getDevice(access)
+	if err != nil {
+		return nil, err
+	}
+
+	return device.stat(path)
 }
 
 func isOpen(src, dst string, table bool) bool {
@@ -310,45 +657,394 @@ func rmOpsPath(src, dst string) {
 
 func iterOps(all bool, o *operation, cfunc func(row, rows int, op *operation)) {
 	app.QueueUpdateDraw(func() {
-		rows := opsView.GetRowCount()
+		walkOps(all, o, cfunc)
+	})
+}
+
+func walkOps(all bool, o *operation, cfunc func(row, rows int, op *operation)) {
+	rows := opsView.GetRowCount()
+
+	for i := 0; i < rows; i++ {
+		cell := opsView.GetCell(i, 0)
+		if cell == nil || cell.NotSelectable {
+			continue
+		}
+
+		ref := cell.GetReference()
+		if ref == nil {
+			continue
+		}
 
-		for i := 0; i < rows; i++ {
-			cell := opsView.GetCell(i, 0)
-			if cell == nil || cell.NotSelectable {
+		op := ref.(*operation)
+		if o != nil {
+			if op != o {
 				continue
 			}
+		}
 
-			ref := cell.GetReference()
-			if ref == nil {
-				continue
+		cfunc(i, rows, op)
+
+		if !all {
+			break
+		}
+	}
+}
+
+func (o *operation) jobFinished() {
+	iterOps(false, o, func(row, rows int, op *operation) {
+		op.done = true
+
+		if op.progress.text == nil || op.opmode == opRename || op.opmode == opMkdir {
+			removeOpsRows(row, rows)
+			return
+		}
+
+		op.showFinished()
+	})
+}
+
+func (o *operation) dismissOps() {
+	walkOps(false, o, func(row, rows int, op *operation) {
+		removeOpsRows(row, rows)
+	})
+}
+
+func dismissFinishedOps() {
+	for i := opsView.GetRowCount() - 1; i >= 0; i-- {
+		ref := opsView.GetCell(i, 0).GetReference()
+		if ref == nil || !ref.(*operation).done {
+			continue
+		}
+
+		removeOpsRows(i, opsView.GetRowCount())
+	}
+}
+
+func removeOpsRows(row, rows int) {
+	opsView.RemoveRow(row)
+	opsView.RemoveRow(row)
+	opsView.RemoveRow(row - 1)
+
+	// The rows of the jobs below the removed job move up.
+	for i := row - 1; i < opsView.GetRowCount(); i++ {
+		if ref := opsView.GetCell(i, 0).GetReference(); ref != nil {
+			ref.(*operation).id -= opRowNum
+		}
+	}
+
+	resetOpsView()
+
+	jobNum = rows - opRowNum
+}
+
+func (o *operation) interrupted() bool {
+	if o.err == nil || (o.items == nil && o.pending == nil) {
+		return false
+	}
+
+	if o.opmode != opCopy && o.opmode != opMove {
+		return false
+	}
+
+	switch o.transfer {
+	case adbToLocal, localToAdb, deviceToDevice:
+		return true
+	}
+
+	return false
+}
+
+func (o *operation) showFinished() {
+	var status string
+
+	desc, _ := o.progress.text.GetReference().(string)
+	o.progress.text.SetText(desc)
+
+	switch {
+	case o.err != nil:
+		status = "[red::b]Failed[-::-]: " + tview.Escape(o.err.Error())
+		if o.err == context.Canceled {
+			status = "[red::b]Cancelled[-::-]: " + tview.Escape(o.summary())
+		}
+
+		if o.failed != nil {
+			status += fmt.Sprintf(", %d file(s) failed verification", len(o.failed))
+		}
+
+		if o.errors != nil {
+			status += fmt.Sprintf(", %d error(s), press e to view them", len(o.errors))
+		}
+
+		if o.interrupted() {
+			status += ", press r to resume or x to dismiss"
+		} else {
+			status += ", press x to dismiss"
+		}
+
+	case o.errors != nil:
+		status = fmt.Sprintf(
+			"[red::b]Completed with %d error(s)[-::-], press e to view them, r to retry or x to dismiss",
+			len(o.errors),
+		)
+
+		if o.failed != nil {
+			status += fmt.Sprintf(" (%d file(s) failed verification)", len(o.failed))
+		}
+
+	case o.failed != nil:
+		var names []string
+
+		for i, file := range o.failed {
+			if i == 5 {
+				names = append(names, "...")
+				break
 			}
 
-			op := ref.(*operation)
-			if o != nil {
-				if op != o {
-					continue
+			names = append(names, filepath.Base(file.src))
+		}
+
+		status = fmt.Sprintf(
+			"[red::b]%d file(s) failed verification[-::-] (%s), press r to retry or x to dismiss",
+			len(o.failed), tview.Escape(strings.Join(names, ", ")),
+		)
+
+	default:
+		status = "[green::b]Completed[-::-]: " + tview.Escape(o.summary()) + ", press x to dismiss"
+	}
+
+	o.progress.prog.SetText("  " + status)
+}
+
+func (o *operation) retryJob() {
+	if !o.done || (o.failed == nil && o.errors == nil && !o.interrupted()) {
+		return
+	}
+
+	o.dismissOps()
+
+	go o.retry()
+}
+
+//gocyclo:ignore
+func (o *operation) retry() {
+	var err error
+	var pending []selection
+	var items []transferItem
+
+	// Files which failed are transferred again, instead of being resumed.
+	seen := make(map[[2]string]struct{})
+	add := func(item transferItem) {
+		key := [2]string{item.src, item.dst}
+		if _, ok := seen[key]; ok {
+			return
+		}
+
+		seen[key] = struct{}{}
+		items = append(items, item)
+	}
+
+	for _, item := range o.failed {
+		add(item)
+	}
+
+	for _, ferr := range o.errors {
+		if ferr.item.src != "" {
+			add(ferr.item)
+		}
+	}
+
+	if o.interrupted() {
+		for _, item := range o.items {
+			item.resume = true
+			add(item)
+		}
+
+		for _, sel := range o.pending {
+			items = append(items, transferItem{
+				src:      sel.path,
+				dst:      filepath.Join(o.dstDir, filepath.Base(sel.path)),
+				access:   sel.access,
+				transfer: transfermode(o.opmode, sel.smode, o.dstMode, sel.access.serial, o.dstDev.serial),
+			})
+		}
+
+		pending = o.pending
+	}
+
+	opmode := o.opmode
+	if opmode == opSync {
+		opmode = opCopy
+	}
+
+	op := newOperation(opmode)
+
+	op.verify = o.verify || o.failed != nil
+	op.keepGoing = o.keepGoing
+	op.srcDev, op.dstDev = o.srcDev, o.dstDev
+	op.dstDir, op.dstMode = o.dstDir, o.dstMode
+	op.transfer = o.transfer
+	op.conflict = o.conflict
+	op.created, op.resolved = o.created, o.resolved
+	op.pending = pending
+
+	err = op.startJob(o.queueDesc+" (retry)", o.devices...)
+
+	// Items which were not reached by the job are checked
+	// for conflicts as usual.
+	unstarted := len(items) - len(pending)
+
+	for i, item := range items {
+		if err != nil {
+			break
+		}
+
+		op.srcDev, op.transfer = item.access, item.transfer
+
+		if i >= unstarted {
+			if opmode == opCopy {
+				var target string
+
+				target, err = op.resolveConflict(item.src, item.dst, true)
+				if err != nil {
+					break
 				}
+
+				item.dst = target
 			}
 
-			cfunc(i, rows, op)
+			op.pending = op.pending[1:]
 
-			if !all {
-				break
+			if item.dst == "" {
+				continue
 			}
 		}
+
+		// Items which were moved completely no longer exist.
+		if item.resume && opmode == opMove {
+			if _, serr := op.statPath(item.src, true); serr != nil {
+				continue
+			}
+		}
+
+		if err = isSamePath(item.src, item.dst, opmode); err != nil {
+			break
+		}
+
+		if err = op.skipError(item.src, item.dst, op.runItem(item, i, len(items))); err != nil {
+			break
+		}
+	}
+
+	op.opSetStatus(opDone, err)
+}
+
+func (o *operation) verifyFile(src, dst string, srcDevice, dstDevice *adbDevice) (bool, error) {
+	srcSum, err := fileChecksum(src, srcDevice)
+	if err != nil {
+		return false, err
+	}
+
+	dstSum, err := fileChecksum(dst, dstDevice)
+	if err != nil {
+		return false, err
+	}
+
+	if srcSum == dstSum {
+		return true, nil
+	}
+
+	o.failed = append(o.failed, transferItem{src: src, dst: dst, access: o.srcDev, transfer: o.transfer})
+
+	return false, nil
+}
+
+func (o *operation) skipError(src, dst string, err error) error {
+	if err == nil || !o.keepGoing || err == context.Canceled {
+		return err
+	}
+
+	o.errors = append(o.errors, fileError{
+		item: transferItem{src: src, dst: dst, access: o.srcDev, transfer: o.transfer},
+		err:  err,
 	})
+
+	return nil
 }
 
-func (o *operation) jobFinished() {
-	iterOps(false, o, func(row, rows int, op *operation) {
-		opsView.RemoveRow(row)
-		opsView.RemoveRow(row)
-		opsView.RemoveRow(row - 1)
+func (o *operation) showErrors() {
+	if !o.done || o.errors == nil {
+		return
+	}
+
+	errTable := tview.NewTable()
+	errTitle := tview.NewTextView()
+
+	errFlex := tview.NewFlex().
+		AddItem(errTitle, 1, 0, false).
+		AddItem(errTable, 0, 1, true).
+		SetDirection(tview.FlexRow)
 
-		resetOpsView()
+	exit := func() {
+		pages.SwitchToPage("ops")
+		pages.RemovePage("errors")
+		app.SetFocus(opsView)
+	}
+
+	for row, ferr := range o.errors {
+		path := ferr.item.src
+		if path == "" {
+			path = ferr.item.dst
+		}
+
+		errTable.SetCell(row, 0, tview.NewTableCell(tview.Escape(path)).
+			SetSelectable(true))
+
+		errTable.SetCell(row, 1, tview.NewTableCell(tview.Escape(ferr.err.Error())).
+			SetExpansion(1).
+			SetTextColor(tcell.ColorOrangeRed).
+			SetSelectable(false))
+	}
+
+	errTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			exit()
+			return nil
+		}
 
-		jobNum = rows - opRowNum
+		switch event.Rune() {
+		case 'r':
+			exit()
+			o.retryJob()
+
+		case 'e', 'q':
+			exit()
+			return nil
+		}
+
+		return event
 	})
+
+	errTable.SetSelectable(true, false)
+	errTable.SetBackgroundColor(tcell.ColorDefault)
+
+	errTitle.SetDynamicColors(true)
+	errTitle.SetText(fmt.Sprintf(
+		"[::bu]Errors (%d)[-::-] - press r to retry, Esc to return",
+		len(o.errors),
+	))
+	errTitle.SetBackgroundColor(tcell.ColorDefault)
+
+	pages.AddAndSwitchToPage("errors", errFlex, true)
+	app.SetFocus(errTable)
+}
+
+func fileChecksum(path string, device *adbDevice) (string, error) {
+	if device == nil {
+		return localChecksum(path)
+	}
+
+	return device.checksum(path)
 }
 
 func (o *operation) cancelOps() {
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/darkhz/tview"
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+var testTree = map[string]string{
+	"dir/a.txt":               "first file",
+	"dir/Bob's photos/b.jpg":  "second file",
+	"dir/sub/deeper/$(id).sh": "third file",
+	"dir/sub/-dash":           "fourth file",
+	"dir/sub/empty":           "",
+}
+
+var testFeatures = map[string][]string{
+	"sync v1": nil,
+	"sync v2": {"stat_v2", "ls_v2"},
+}
+
+func startTestUI(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	app = tview.NewApplication()
+	pages = tview.NewPages()
+
+	prevPane = &dirPane{table: tview.NewTable()}
+
+	pages.AddPage("main", prevPane.table, true, false)
+	pages.AddPage("ops", setupOpsView(), true, true)
+	app.SetScreen(screen).SetRoot(pages, true)
+
+	setupStatus()
+
+	done := make(chan struct{})
+	go func() {
+		app.Run()
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		stopStatus()
+		app.Stop()
+		<-done
+	})
+}
+
+// newTestPane returns a pane which is locked,
+// so that it is not reloaded after operations.
+func newTestPane(mode ifaceMode, path string) *dirPane {
+	pane := &dirPane{
+		mode:  mode,
+		path:  path,
+		table: tview.NewTable(),
+		title: tview.NewTextView(),
+		plock: semaphore.NewWeighted(1),
+
+		deviceAccess: deviceAccess{serial: fakeSerial},
+	}
+
+	pane.plock.TryAcquire(1)
+
+	return pane
+}
+
+func runTestOp(t *testing.T, opmode opsMode, srcPane, dstPane *dirPane, name string) {
+	t.Helper()
+
+	mselect := []selection{{
+		path:   filepath.Join(srcPane.path, name),
+		smode:  srcPane.mode,
+		access: srcPane.deviceAccess,
+	}}
+
+	if _, err := startOperation(srcPane, dstPane, opmode, false, mselect); err != nil {
+		t.Fatalf("%s of %s: %v", opmode, name, err)
+	}
+}
+
+func writeTree(t testing.TB, root string, tree map[string]string) {
+	t.Helper()
+
+	for name, data := range tree {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	tree := make(map[string]string)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		tree[rel] = string(data)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func checkTree(t *testing.T, root string, tree map[string]string) {
+	t.Helper()
+
+	if got := readTree(t, root); !reflect.DeepEqual(got, tree) {
+		t.Errorf("tree at %s:\ngot  %v\nwant %v", root, got, tree)
+	}
+}
+
+func checkMissing(t *testing.T, path string) {
+	t.Helper()
+
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", path)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	startTestUI(t)
+
+	for name, features := range testFeatures {
+		features := features
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("push", func(t *testing.T) {
+				testTransfer(t, features, mLocal, mAdb)
+			})
+
+			t.Run("pull", func(t *testing.T) {
+				testTransfer(t, features, mAdb, mLocal)
+			})
+
+			t.Run("device", func(t *testing.T) {
+				testTransfer(t, features, mAdb, mAdb)
+			})
+
+			t.Run("delete", func(t *testing.T) {
+				testDelete(t, features)
+			})
+		})
+	}
+}
+
+// testTransfer copies the test tree from one side to the other,
+// and then moves the copy back next to the original.
+func testTransfer(t *testing.T, features []string, srcMode, dstMode ifaceMode) {
+	device := newFakeAdb(t, features...)
+
+	local := t.TempDir()
+	roots := map[ifaceMode]string{mLocal: local, mAdb: "/sdcard"}
+	paths := map[ifaceMode]func(string) string{
+		mLocal: func(p string) string { return p },
+		mAdb:   device.path,
+	}
+
+	srcDir, dstDir := roots[srcMode]+"/src", roots[dstMode]+"/copy"
+	srcPath, dstPath := paths[srcMode], paths[dstMode]
+
+	writeTree(t, srcPath(srcDir), testTree)
+
+	if err := os.MkdirAll(dstPath(dstDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runTestOp(t, opCopy, newTestPane(srcMode, srcDir), newTestPane(dstMode, dstDir), "dir")
+	device.settle()
+
+	checkTree(t, srcPath(srcDir), testTree)
+	checkTree(t, dstPath(dstDir), testTree)
+
+	moved := roots[srcMode] + "/moved"
+	if err := os.MkdirAll(srcPath(moved), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runTestOp(t, opMove, newTestPane(dstMode, dstDir), newTestPane(srcMode, moved), "dir")
+	device.settle()
+
+	checkTree(t, srcPath(moved), testTree)
+	checkMissing(t, dstPath(dstDir+"/dir"))
+}
+
+func testDelete(t *testing.T, features []string) {
+	device := newFakeAdb(t, features...)
+
+	writeTree(t, device.path("/sdcard"), testTree)
+	writeTree(t, device.path("/sdcard"), map[string]string{"kept.txt": "kept", "gone.txt": "gone"})
+
+	pane := newTestPane(mAdb, "/sdcard")
+
+	runTestOp(t, opDelete, pane, pane, "dir")
+	runTestOp(t, opDelete, pane, pane, "gone.txt")
+	device.settle()
+
+	checkMissing(t, device.path("/sdcard/dir"))
+	checkTree(t, device.path("/sdcard"), map[string]string{"kept.txt": "kept"})
+}
+
+// TestMoveShortRead checks that a file which is moved from the device
+// is kept there, if fewer bytes than its size could be read from it.
+func TestMoveShortRead(t *testing.T) {
+	startTestUI(t)
+
+	for _, root := range []bool{false, true} {
+		device := newFakeAdb(t)
+		local := t.TempDir()
+
+		writeTree(t, device.path("/sdcard"), map[string]string{"short.txt": "cut short"})
+		device.shortRead("/sdcard/short.txt", 3)
+
+		srcPane := newTestPane(mAdb, "/sdcard")
+		srcPane.root = root
+
+		mselect := []selection{{
+			path:   "/sdcard/short.txt",
+			smode:  mAdb,
+			access: srcPane.deviceAccess,
+		}}
+
+		_, err := startOperation(srcPane, newTestPane(mLocal, local), opMove, false, mselect)
+		if err == nil {
+			t.Errorf("root %v: move of a file which was read partially succeeded", root)
+		}
+
+		checkTree(t, device.path("/sdcard"), map[string]string{"short.txt": "cut short"})
+	}
+}
+
+func TestSplitExt(t *testing.T) {
+	tests := []struct {
+		name, base, ext string
+	}{
+		{"photo.jpg", "photo", ".jpg"},
+		{"README", "README", ""},
+		{".bashrc", ".bashrc", ""},
+		{"a.tar.gz", "a", ".tar.gz"},
+		{"a.tar", "a", ".tar"},
+		{"a.b.gz", "a.b", ".gz"},
+		{".tar.gz", ".tar", ".gz"},
+	}
+
+	for _, test := range tests {
+		base, ext := splitExt(test.name)
+		if base != test.base || ext != test.ext {
+			t.Errorf("splitExt(%q): got %q, %q, want %q, %q", test.name, base, ext, test.base, test.ext)
+		}
+	}
+}
+
+func TestDupName(t *testing.T) {
+	format := dupFormat
+	defer func() { dupFormat = format }()
+
+	tests := []struct {
+		format, name string
+		n            int
+		want         string
+	}{
+		{"number", "photo.jpg", 1, "photo (1).jpg"},
+		{"number", "photo.jpg", 2, "photo (2).jpg"},
+		{"number", ".bashrc", 1, ".bashrc (1)"},
+		{"number", "a.tar.gz", 1, "a (1).tar.gz"},
+		{"number", "IMG (1).jpg", 1, "IMG (2).jpg"},
+		{"number", "IMG (1).jpg", 3, "IMG (4).jpg"},
+		{"number", "dir", 1, "dir (1)"},
+		{"copy", "photo.jpg", 1, "photo_copy.jpg"},
+		{"copy", "photo.jpg", 2, "photo_copy2.jpg"},
+		{"copy", ".bashrc", 1, ".bashrc_copy"},
+		{"copy", "a.tar.gz", 1, "a_copy.tar.gz"},
+		{"copy", "IMG (1).jpg", 1, "IMG (1)_copy.jpg"},
+	}
+
+	for _, test := range tests {
+		dupFormat = test.format
+
+		name, ext := splitExt(test.name)
+		if got := dupName(name, ext, test.n); got != test.want {
+			t.Errorf("%s: dupName(%q, %d): got %q, want %q", test.format, test.name, test.n, got, test.want)
+		}
+	}
+}
@@ -21,18 +21,33 @@ type progressMode struct {
 	lock *semaphore.Weighted
 }
 
+type jobStats struct {
+	start    time.Time
+	end      time.Time
+	done     int64
+	skipped  int64
+	last     int64
+	lastTime time.Time
+	rate     float64
+}
+
 type opStatus int
 
 const (
-	opInProgress opStatus = iota
+	opWaiting opStatus = iota
+	opInProgress
 	opDone
 )
 
 const opRowNum = 3
 
+const statsInterval = time.Second
+
 var (
 	progWidth  int
+	opsRunning int
 	updateLock sync.Mutex
+	statsLock  sync.Mutex
 )
 
 func (o operation) getDescription() string {
@@ -53,6 +68,14 @@ func (o *operation) createPb() {
 	}
 	defer o.progress.lock.Release(1)
 
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	// The bytes transferred for the previous item of the job are kept.
+	if o.progress.pbar != nil && o.byteProgress() {
+		o.stats.done += int64(o.progress.pbar.State().CurrentBytes)
+	}
+
 	o.progress.pbar = progressbar.NewOptions64(
 		o.totalBytes,
 		progressbar.OptionFullWidth(),
@@ -89,40 +112,49 @@ func (o *operation) updatePb() {
 	o.progress.pbar.Describe(o.getDescription())
 }
 
-func (o *operation) setNewProgress(src, dst string, selindex, seltotal int) error {
-	var pstr string
-	var tpath string
-
+func (o *operation) describe(src, dst string) string {
 	opstr := o.opmode.String()
 
 	srcstr := tview.Escape(filepath.Base(src))
 	dstdir := tview.Escape(trimPath(filepath.Dir(dst), false))
 
-	tpath = "  " + opString(opstr) + " "
+	desc := "  " + opString(opstr) + " "
 
 	switch o.opmode {
 	case opDelete, opMkdir:
-		tpath += srcstr
-
-	case opCopy:
-		pstr = "Calculating.."
-		fallthrough
+		desc += srcstr
 
 	default:
-		tpath += "'" + srcstr + "' to '" + dstdir + "'"
+		desc += "'" + srcstr + "' to '" + dstdir + "'"
+	}
+
+	return desc
+}
+
+func (o *operation) setNewProgress(src, dst string, selindex, seltotal int) error {
+	var pstr string
+
+	tpath := o.describe(src, dst)
+
+	if o.byteProgress() {
+		pstr = "Calculating.."
 	}
 
 	o.currFile = 0
 	o.totalFile = 0
 
+	statsLock.Lock()
+	o.totalBytes = -1
+	statsLock.Unlock()
+
 	if seltotal > 1 {
 		tpath += fmt.Sprintf(" (%d of %d)", selindex+1, seltotal)
 	}
 
 	o.updateOpsView(false, tpath, pstr)
 
-	if o.opmode != opRename || o.opmode != opMkdir {
-		if o.opmode == opCopy {
+	if o.opmode != opRename && o.opmode != opMkdir {
+		if o.byteProgress() {
 			err := o.getTotalFiles(src)
 			if err != nil {
 				return err
@@ -131,7 +163,7 @@ func (o *operation) setNewProgress(src, dst string, selindex, seltotal int) erro
 
 		o.createPb()
 
-		if o.opmode != opCopy || o.transfer == adbToAdb {
+		if !o.byteProgress() {
 			go func() {
 				if !o.progress.lock.TryAcquire(1) {
 					return
@@ -162,12 +194,46 @@ func (o *operation) opSetStatus(status opStatus, err error) {
 	defer updateLock.Unlock()
 
 	switch status {
-	case opInProgress:
+	case opWaiting:
 		jobNum += opRowNum
 		o.updateOpsView(true)
 
+		app.QueueUpdateDraw(o.showWaiting)
+
+	case opInProgress:
+		if o.started == nil {
+			jobNum += opRowNum
+			o.updateOpsView(true)
+		}
+
+		opsRunning++
+
+		o.stats.start = time.Now()
+		if o.opmode != opRename && o.opmode != opMkdir {
+			go o.trackStats()
+		}
+
 	case opDone:
+		o.stats.end = time.Now()
+		o.transferred()
+
 		o.cancel()
+		o.release()
+		releasePaths(o.reserved...)
+
+		opsRunning--
+
+		o.err = err
+
+		switch {
+		case err != nil:
+
+		case o.errors != nil:
+			err = fmt.Errorf("Completed with %d error(s)", len(o.errors))
+
+		case o.failed != nil:
+			err = fmt.Errorf("%d file(s) failed verification", len(o.failed))
+		}
 
 		if err != nil {
 			if err != context.Canceled {
@@ -180,9 +246,9 @@ func (o *operation) opSetStatus(status opStatus, err error) {
 		o.jobFinished()
 	}
 
-	if o.opmode != opRename && o.opmode != opMkdir {
-		if jobNum > 0 {
-			text := strconv.Itoa(jobNum/opRowNum) + " job(s) are running"
+	if status != opWaiting && o.opmode != opRename && o.opmode != opMkdir {
+		if opsRunning > 0 {
+			text := strconv.Itoa(opsRunning) + " job(s) are running"
 			msgchan <- message{text, true}
 		} else {
 			msgchan <- message{"", true}
@@ -202,27 +268,155 @@ func (o *operation) updateOpsView(init bool, msg ...string) {
 			return
 		}
 
-		o.progress.prog = tview.NewTableCell("")
-		o.progress.text = tview.NewTableCell("")
+		o.setOpsRows(msg[0], msg[1])
+	})
+}
 
-		opsView.SetCell(o.id+1, 0, tview.NewTableCell("*").
-			SetReference(o).
-			SetSelectable(true))
+func (o *operation) setOpsRows(text, prog string) {
+	o.progress.prog = tview.NewTableCell("")
+	o.progress.text = tview.NewTableCell("")
+
+	opsView.SetCell(o.id+1, 0, tview.NewTableCell("*").
+		SetReference(o).
+		SetSelectable(true))
+
+	opsView.SetCell(o.id+1, 1, o.progress.text.
+		SetText(text).
+		SetExpansion(1).
+		SetReference(text).
+		SetSelectable(false).
+		SetAlign(tview.AlignLeft))
+
+	opsView.SetCell(o.id+2, 0, tview.NewTableCell("").
+		SetSelectable(false))
+
+	opsView.SetCell(o.id+2, 1, o.progress.prog.
+		SetText(prog).
+		SetExpansion(1).
+		SetSelectable(false).
+		SetAlign(tview.AlignLeft))
+}
 
-		opsView.SetCell(o.id+1, 1, o.progress.text.
-			SetText(msg[0]).
-			SetExpansion(1).
-			SetReference(msg[0]).
-			SetSelectable(false).
-			SetAlign(tview.AlignLeft))
+func (o *operation) transferred() int64 {
+	statsLock.Lock()
+	defer statsLock.Unlock()
 
-		opsView.SetCell(o.id+2, 0, tview.NewTableCell("").
-			SetSelectable(false))
+	if !o.byteProgress() {
+		return 0
+	}
 
-		opsView.SetCell(o.id+2, 1, o.progress.prog.
-			SetText(msg[1]).
-			SetExpansion(1).
-			SetSelectable(false).
-			SetAlign(tview.AlignLeft))
-	})
+	if o.progress.pbar != nil {
+		o.stats.last = o.stats.done + int64(o.progress.pbar.State().CurrentBytes) - o.stats.skipped
+	}
+
+	return o.stats.last
+}
+
+func (o *operation) skipBytes(n int64) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	o.stats.skipped += n
+	o.progress.pbar.Add64(n)
+}
+
+func (o *operation) trackStats() {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		text := o.statsText()
+
+		app.QueueUpdateDraw(func() {
+			if o.done || o.progress.text == nil {
+				return
+			}
+
+			desc, _ := o.progress.text.GetReference().(string)
+			if o.paused() {
+				desc += " [yellow::b](paused)[-::-]"
+			}
+
+			o.progress.text.SetText(desc + text)
+		})
+	}
+}
+
+func (o *operation) statsText() string {
+	now := time.Now()
+	elapsed := now.Sub(o.stats.start)
+
+	if !o.byteProgress() {
+		return " (" + formatDuration(elapsed) + ")"
+	}
+
+	prev, prevTime := o.stats.last, o.stats.lastTime
+	bytes := o.transferred()
+
+	// The current speed is smoothed over the previous updates.
+	if !prevTime.IsZero() {
+		rate := float64(bytes-prev) / now.Sub(prevTime).Seconds()
+		o.stats.rate = (o.stats.rate + rate) / 2
+	}
+
+	o.stats.lastTime = now
+
+	text := fmt.Sprintf(
+		" - %s/s (avg %s/s), %s elapsed",
+		getSizeString(int64(o.stats.rate)),
+		getSizeString(int64(float64(bytes)/elapsed.Seconds())),
+		formatDuration(elapsed),
+	)
+
+	statsLock.Lock()
+	left := o.totalBytes
+	if o.progress.pbar != nil {
+		left -= int64(o.progress.pbar.State().CurrentBytes)
+	}
+	statsLock.Unlock()
+
+	if o.stats.rate > 0 && left > 0 {
+		text += ", " + formatDuration(time.Duration(float64(left)/o.stats.rate)*time.Second) + " left"
+	}
+
+	return tview.Escape(text)
+}
+
+func (o *operation) summary() string {
+	elapsed := o.stats.end.Sub(o.stats.start)
+
+	if !o.byteProgress() {
+		return "Finished in " + formatDuration(elapsed)
+	}
+
+	rate := float64(o.stats.last)
+	if elapsed > 0 {
+		rate /= elapsed.Seconds()
+	}
+
+	return fmt.Sprintf(
+		"Transferred %s in %s (avg %s/s)",
+		getSizeString(o.stats.last), formatDuration(elapsed), getSizeString(int64(rate)),
+	)
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+
+	return fmt.Sprintf("%02d:%02d", m, s)
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"io"
+	"sync"
+
+	"github.com/dolmen-go/contextio"
+)
+
+type pauseReader struct {
+	op     *operation
+	reader io.Reader
+}
+
+const localJobs = "local"
+
+var (
+	maxJobs int
+
+	jobQueue    []*operation
+	runningJobs = make(map[string]int)
+	queueLock   sync.Mutex
+
+	pauseLock sync.Mutex
+)
+
+func (o *operation) startJob(desc string, devices ...string) error {
+	if o.opmode == opRename || o.opmode == opMkdir {
+		o.opSetStatus(opInProgress, nil)
+		return nil
+	}
+
+	o.devices = nil
+	for _, device := range devices {
+		if !containsString(o.devices, device) {
+			o.devices = append(o.devices, device)
+		}
+	}
+
+	if o.devices == nil {
+		o.devices = []string{localJobs}
+	}
+
+	o.queueDesc = desc
+	o.opSetStatus(opWaiting, nil)
+
+	err := o.acquire()
+
+	o.opSetStatus(opInProgress, nil)
+
+	return err
+}
+
+func (o *operation) acquire() error {
+	o.started = make(chan struct{})
+
+	queueLock.Lock()
+	jobQueue = append(jobQueue, o)
+	queueLock.Unlock()
+
+	startQueued()
+
+	select {
+	case <-o.started:
+		return nil
+
+	case <-o.ctx.Done():
+	}
+
+	queueLock.Lock()
+	defer queueLock.Unlock()
+
+	for i, op := range jobQueue {
+		if op == o {
+			jobQueue = append(jobQueue[:i], jobQueue[i+1:]...)
+			break
+		}
+	}
+
+	return o.ctx.Err()
+}
+
+func (o *operation) release() {
+	queueLock.Lock()
+
+	if o.acquired {
+		for _, device := range o.devices {
+			runningJobs[device]--
+		}
+
+		o.acquired = false
+	}
+
+	queueLock.Unlock()
+
+	startQueued()
+}
+
+func startQueued() {
+	var queue []*operation
+
+	queueLock.Lock()
+	defer queueLock.Unlock()
+
+	blocked := make(map[string]struct{})
+
+	for _, op := range jobQueue {
+		free := true
+
+		for _, device := range op.devices {
+			_, block := blocked[device]
+			if block || (maxJobs > 0 && runningJobs[device] >= maxJobs) {
+				free = false
+			}
+		}
+
+		if !free {
+			for _, device := range op.devices {
+				blocked[device] = struct{}{}
+			}
+
+			queue = append(queue, op)
+			continue
+		}
+
+		for _, device := range op.devices {
+			runningJobs[device]++
+		}
+
+		op.acquired = true
+		close(op.started)
+	}
+
+	jobQueue = queue
+}
+
+func (o *operation) moveQueued(up bool) {
+	var other *operation
+
+	queueLock.Lock()
+
+	for i, op := range jobQueue {
+		if op != o {
+			continue
+		}
+
+		j := i + 1
+		if up {
+			j = i - 1
+		}
+
+		if j >= 0 && j < len(jobQueue) {
+			other = jobQueue[j]
+			jobQueue[i], jobQueue[j] = other, o
+		}
+
+		break
+	}
+
+	queueLock.Unlock()
+
+	if other == nil {
+		return
+	}
+
+	o.id, other.id = other.id, o.id
+
+	o.showWaiting()
+	other.showWaiting()
+
+	opsView.Select(o.id+1, 0)
+}
+
+func (o *operation) showWaiting() {
+	o.setOpsRows(o.queueDesc, "  [yellow::b]Waiting[-::-]")
+}
+
+func (o *operation) togglePause() {
+	if o.done || o.started == nil {
+		return
+	}
+
+	select {
+	case <-o.started:
+
+	default:
+		return
+	}
+
+	pauseLock.Lock()
+
+	if o.pause != nil {
+		close(o.pause)
+		o.pause = nil
+	} else {
+		o.pause = make(chan struct{})
+	}
+
+	paused := o.pause != nil
+
+	pauseLock.Unlock()
+
+	if o.progress.text == nil {
+		return
+	}
+
+	desc, _ := o.progress.text.GetReference().(string)
+	if paused {
+		desc += " [yellow::b](paused)[-::-]"
+	}
+
+	o.progress.text.SetText(desc)
+}
+
+func (o *operation) paused() bool {
+	pauseLock.Lock()
+	defer pauseLock.Unlock()
+
+	return o.pause != nil
+}
+
+func (o *operation) waitPaused() error {
+	pauseLock.Lock()
+	pause := o.pause
+	pauseLock.Unlock()
+
+	if pause == nil {
+		return nil
+	}
+
+	select {
+	case <-pause:
+		return nil
+
+	case <-o.ctx.Done():
+		return o.ctx.Err()
+	}
+}
+
+func (o *operation) reader(r io.Reader) io.Reader {
+	return &pauseReader{o, contextio.NewReader(o.ctx, r)}
+}
+
+func (p *pauseReader) Read(b []byte) (int, error) {
+	if err := p.op.waitPaused(); err != nil {
+		return 0, err
+	}
+
+	return p.reader.Read(b)
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
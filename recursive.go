@@ -1,48 +1,116 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/dolmen-go/contextio"
 	"github.com/schollz/progressbar/v3"
-	adb "github.com/zach-klippenstein/goadb"
 )
 
-func (o *operation) pullFile(src, dst string, entry *adb.DirEntry, device *adb.Device, recursive bool) error {
-	remote, err := device.OpenRead(src)
+const sizePollInterval = 500 * time.Millisecond
+
+func (o *operation) pullFile(src, dst string, entry *dirEntry, device *adbDevice, recursive bool) error {
+	var offset int64
+	var complete bool
+
+	if entry.Mode.IsRegular() {
+		offset, complete = o.resumeOffset(dst, entry.Size, nil)
+	}
+
+	o.skipBytes(offset)
+	o.created[dst] = struct{}{}
+
+	written := offset
+	if !complete {
+		n, err := o.pullData(src, dst, offset, device)
+		if err != nil {
+			return err
+		}
+
+		written += n
+	}
+
+	// The permissions of a symlink's target are not known here.
+	if entry.Mode.IsRegular() {
+		if err := o.setAttributes(dst, entry.Mode, entry.ModifiedAt, nil); err != nil {
+			return err
+		}
+	}
+
+	if o.verify {
+		ok, err := o.verifyFile(src, dst, device, nil)
+		if err != nil {
+			return err
+		} else if !ok {
+			o.updatePb()
+			return nil
+		}
+	}
+
+	if o.opmode == opMove {
+		size := entry.Size
+
+		// The contents of a symlink's target were read.
+		if entry.Mode&os.ModeSymlink != 0 {
+			var err error
+
+			size, err = device.targetSize(src)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := verifyMove(src, dst, written, size); err != nil {
+			return err
+		}
+
+		if err := removeAdbFile(src, "rm -f", device); err != nil {
+			return err
+		}
+	}
+
+	o.updatePb()
+
+	return nil
+}
+
+func (o *operation) pullData(src, dst string, offset int64, device *adbDevice) (int64, error) {
+	remote, err := device.openReadFrom(src, offset)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer remote.Close()
 
-	local, err := os.Create(dst)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+
+	local, err := os.OpenFile(dst, flags, 0666)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer local.Close()
 
-	cioIn := contextio.NewReader(o.ctx, remote)
+	cioIn := o.reader(remote)
 	prgIn := progressbar.NewReader(cioIn, o.progress.pbar)
 
-	_, err = io.Copy(local, &prgIn)
+	n, err := io.Copy(local, &prgIn)
 	if err != nil {
-		return err
+		local.Close()
+		return n, err
 	}
 
-	o.updatePb()
-
-	return nil
+	return n, local.Close()
 }
 
-func (o *operation) pullRecursive(src, dst string, device *adb.Device) error {
+func (o *operation) pullRecursive(src, dst string, device *adbDevice) error {
 	select {
 	case <-o.ctx.Done():
 		return o.ctx.Err()
@@ -50,11 +118,11 @@ func (o *operation) pullRecursive(src, dst string, device *adb.Device) error {
 	default:
 	}
 
-	if o.opmode != opCopy {
+	if o.opmode != opCopy && o.opmode != opMove {
 		return fmt.Errorf("%s not implemented via pull", o.opmode.String())
 	}
 
-	stat, err := device.Stat(src)
+	stat, err := device.stat(src)
 	if err != nil {
 		return err
 	}
@@ -63,39 +131,62 @@ func (o *operation) pullRecursive(src, dst string, device *adb.Device) error {
 		return o.pullFile(src, dst, stat, device, false)
 	}
 
+	errs, failed := len(o.errors), len(o.failed)
+
 	if err = os.MkdirAll(dst, stat.Mode); err != nil {
 		return err
 	}
 
-	list, err := device.ListDirEntries(src)
+	list, err := device.listDir(src)
+	if err != nil {
+		return err
+	}
 
-	for list.Next() {
-		entry := list.Entry()
+	for _, entry := range list {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
 
 		s := filepath.Join(src, entry.Name)
 		d := filepath.Join(dst, entry.Name)
 
 		if entry.Mode&os.ModeDir != 0 {
-			if err = o.pullRecursive(s, d, device); err != nil {
+			if err = o.skipError(s, d, o.pullRecursive(s, d, device)); err != nil {
 				return err
 			}
 			continue
 		}
 
-		if err = o.pullFile(s, d, entry, device, true); err != nil {
+		d, err = o.resolveConflict(s, d, false)
+		if err != nil {
+			return err
+		} else if d == "" {
+			continue
+		}
+
+		if err = o.skipError(s, d, o.pullFile(s, d, entry, device, true)); err != nil {
 			return err
 		}
 	}
-	if list.Err() != nil {
+
+	if err = o.setAttributes(dst, stat.Mode, stat.ModifiedAt, nil); err != nil {
 		return err
 	}
 
+	// Files which were skipped or failed verification are still in the directory.
+	if o.opmode == opMove && len(o.errors) == errs && len(o.failed) == failed {
+		return removeAdbFile(src, "rmdir", device)
+	}
+
 	return nil
 }
 
-func (o *operation) pushFile(src, dst string, entry os.FileInfo, device *adb.Device, recursive bool) error {
+func (o *operation) pushFile(src, dst string, entry os.FileInfo, device *adbDevice, recursive bool) error {
 	var err error
 
+	// A moved symlink is removed itself, not its target.
+	entryPath := src
+
 	switch {
 	case entry.Mode()&os.ModeSymlink != 0:
 		src, err = filepath.EvalSymlinks(src)
@@ -107,36 +198,92 @@ func (o *operation) pushFile(src, dst string, entry os.FileInfo, device *adb.Dev
 		return nil
 	}
 
-	mtime := entry.ModTime()
-	perms := entry.Mode().Perm()
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	offset, complete := o.resumeOffset(dst, info.Size(), device)
+
+	o.skipBytes(offset)
+	o.created[dst] = struct{}{}
+
+	written := offset
+	if !complete {
+		n, err := o.pushData(src, dst, offset, entry.Mode().Perm(), entry.ModTime(), device)
+		if err != nil {
+			return err
+		}
+
+		written += n
+	}
+
+	if o.verify {
+		ok, err := o.verifyFile(src, dst, nil, device)
+		if err != nil {
+			return err
+		} else if !ok {
+			o.updatePb()
+			return nil
+		}
+	}
+
+	if o.opmode == opMove {
+		stat, err := device.stat(dst)
+		if err != nil {
+			return err
+		}
+
+		if err = verifyMove(src, dst, stat.Size, written); err != nil {
+			return err
+		}
+
+		if err = os.Remove(entryPath); err != nil {
+			return err
+		}
+	}
+
+	o.updatePb()
+
+	return nil
+}
+
+func (o *operation) pushData(src, dst string, offset int64, perms os.FileMode, mtime time.Time, device *adbDevice) (int64, error) {
+	var remote io.WriteCloser
 
 	local, err := os.Open(src)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer local.Close()
 
-	remote, err := device.OpenWrite(dst, perms, mtime)
+	if _, err = local.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if offset > 0 {
+		remote, err = device.openAppend(dst)
+	} else {
+		remote, err = device.openWrite(dst, perms, mtime)
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer remote.Close()
 
-	cioIn := contextio.NewReader(o.ctx, local)
+	cioIn := o.reader(local)
 	prgIn := progressbar.NewReader(cioIn, o.progress.pbar)
 
-	_, err = io.Copy(remote, &prgIn)
+	n, err := io.Copy(remote, &prgIn)
 	if err != nil {
-		return err
+		remote.Close()
+		return n, err
 	}
 
-	o.updatePb()
-
-	return nil
+	return n, remote.Close()
 }
 
 //gocyclo:ignore
-func (o *operation) pushRecursive(src, dst string, device *adb.Device) error {
+func (o *operation) pushRecursive(src, dst string, device *adbDevice) error {
 	select {
 	case <-o.ctx.Done():
 		return o.ctx.Err()
@@ -144,7 +291,7 @@ func (o *operation) pushRecursive(src, dst string, device *adb.Device) error {
 	default:
 	}
 
-	if o.opmode != opCopy {
+	if o.opmode != opCopy && o.opmode != opMove {
 		return fmt.Errorf("%s not implemented via push", o.opmode.String())
 	}
 
@@ -157,50 +304,345 @@ func (o *operation) pushRecursive(src, dst string, device *adb.Device) error {
 		return o.pushFile(src, dst, stat, device, false)
 	}
 
+	errs, failed := len(o.errors), len(o.failed)
+
 	srcfd, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer srcfd.Close()
 
-	cmd := fmt.Sprintf("mkdir '%s'", dst)
-	out, err := device.RunCommand(cmd)
+	if err = makeAdbDir(dst, stat.Mode(), device); err != nil {
+		return err
+	}
+
+	list, err := ioutil.ReadDir(src)
 	if err != nil {
 		return err
-	} else if out != "" {
-		return fmt.Errorf(out)
 	}
 
-	mode := fmt.Sprintf("%04o", stat.Mode().Perm())
-	cmd = fmt.Sprintf("chmod %s '%s'", mode, dst)
-	out, err = device.RunCommand(cmd)
+	for _, entry := range list {
+		s := filepath.Join(src, entry.Name())
+		d := filepath.Join(dst, entry.Name())
+
+		if entry.IsDir() {
+			if err = o.skipError(s, d, o.pushRecursive(s, d, device)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		d, err = o.resolveConflict(s, d, false)
+		if err != nil {
+			return err
+		} else if d == "" {
+			continue
+		}
+
+		if err = o.skipError(s, d, o.pushFile(s, d, entry, device, true)); err != nil {
+			return err
+		}
+	}
+
+	if o.opmode == opMove && len(o.errors) == errs && len(o.failed) == failed {
+		srcfd.Close()
+		return os.Remove(src)
+	}
+
+	return nil
+}
+
+func (o *operation) transferFile(src, dst string, entry *dirEntry, srcDevice, dstDevice *adbDevice) error {
+	var offset int64
+	var complete bool
+
+	if entry.Mode.IsRegular() {
+		offset, complete = o.resumeOffset(dst, entry.Size, dstDevice)
+	}
+
+	o.skipBytes(offset)
+	o.created[dst] = struct{}{}
+
+	if !complete {
+		if err := o.transferData(src, dst, offset, entry, srcDevice, dstDevice); err != nil {
+			return err
+		}
+	}
+
+	if o.verify {
+		if _, err := o.verifyFile(src, dst, srcDevice, dstDevice); err != nil {
+			return err
+		}
+	}
+
+	o.updatePb()
+
+	return nil
+}
+
+func (o *operation) transferData(src, dst string, offset int64, entry *dirEntry, srcDevice, dstDevice *adbDevice) error {
+	var target io.WriteCloser
+
+	remote, err := srcDevice.openReadFrom(src, offset)
 	if err != nil {
 		return err
-	} else if out != "" {
-		return fmt.Errorf(out)
 	}
+	defer remote.Close()
 
-	list, err := ioutil.ReadDir(src)
+	if offset > 0 {
+		target, err = dstDevice.openAppend(dst)
+	} else {
+		target, err = dstDevice.openWrite(dst, entry.Mode.Perm(), entry.ModifiedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	cioIn := o.reader(remote)
+	prgIn := progressbar.NewReader(cioIn, o.progress.pbar)
+
+	_, err = io.Copy(target, &prgIn)
+	if err != nil {
+		target.Close()
+		return err
+	}
+
+	return target.Close()
+}
+
+func (o *operation) transferRecursive(src, dst string, srcDevice, dstDevice *adbDevice) error {
+	select {
+	case <-o.ctx.Done():
+		return o.ctx.Err()
+
+	default:
+	}
+
+	if o.opmode != opCopy {
+		return fmt.Errorf("%s not implemented between devices", o.opmode.String())
+	}
+
+	stat, err := srcDevice.stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !stat.Mode.IsDir() {
+		return o.transferFile(src, dst, stat, srcDevice, dstDevice)
+	}
+
+	if err = makeAdbDir(dst, stat.Mode, dstDevice); err != nil {
+		return err
+	}
+
+	list, err := srcDevice.listDir(src)
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range list {
-		s := filepath.Join(src, entry.Name())
-		d := filepath.Join(dst, entry.Name())
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
 
-		if entry.IsDir() {
-			if err = o.pushRecursive(s, d, device); err != nil {
+		s := filepath.Join(src, entry.Name)
+		d := filepath.Join(dst, entry.Name)
+
+		if entry.Mode&os.ModeDir != 0 {
+			if err = o.skipError(s, d, o.transferRecursive(s, d, srcDevice, dstDevice)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		d, err = o.resolveConflict(s, d, false)
+		if err != nil {
+			return err
+		} else if d == "" {
+			continue
+		}
+
+		if err = o.skipError(s, d, o.transferFile(s, d, entry, srcDevice, dstDevice)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *operation) copyAdbRecursive(src, dst string, device *adbDevice) error {
+	select {
+	case <-o.ctx.Done():
+		return o.ctx.Err()
+
+	default:
+	}
+
+	stat, err := device.stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !stat.Mode.IsDir() {
+		return o.copyAdbFile(src, dst, stat, device)
+	}
+
+	if err = makeAdbDir(dst, stat.Mode, device); err != nil {
+		return err
+	}
+
+	list, err := device.listDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range list {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		s := filepath.Join(src, entry.Name)
+		d := filepath.Join(dst, entry.Name)
+
+		if entry.Mode&os.ModeDir != 0 {
+			if err = o.skipError(s, d, o.copyAdbRecursive(s, d, device)); err != nil {
 				return err
 			}
 			continue
 		}
 
-		if err = o.pushFile(s, d, entry, device, true); err != nil {
+		d, err = o.resolveConflict(s, d, false)
+		if err != nil {
+			return err
+		} else if d == "" {
+			continue
+		}
+
+		if err = o.skipError(s, d, o.copyAdbFile(s, d, entry, device)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *operation) copyAdbFile(src, dst string, entry *dirEntry, device *adbDevice) error {
+	if err := o.waitPaused(); err != nil {
+		return err
+	}
+
+	stop := o.watchSize(dst, entry.Size, device)
+
+	out, err := device.runContext(o.ctx, shellJoin("cp -P", src, dst))
+
+	added := stop()
+
+	if err != nil {
+		return err
+	} else if out != "" {
+		return errors.New(strings.TrimSpace(out))
+	}
+
+	o.progress.pbar.Add64(entry.Size - added)
+
+	if o.verify && entry.Mode.IsRegular() {
+		if _, err := o.verifyFile(src, dst, device, device); err != nil {
 			return err
 		}
 	}
 
+	o.updatePb()
+
+	return nil
+}
+
+func (o *operation) watchSize(path string, size int64, device *adbDevice) func() int64 {
+	var added int64
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(sizePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+			}
+
+			stat, err := device.stat(path)
+			if err != nil || stat.Size <= added || stat.Size > size {
+				continue
+			}
+
+			o.progress.pbar.Add64(stat.Size - added)
+			added = stat.Size
+		}
+	}()
+
+	return func() int64 {
+		close(done)
+		<-stopped
+
+		return added
+	}
+}
+
+func (o *operation) resumeOffset(dst string, size int64, device *adbDevice) (int64, bool) {
+	var partial int64
+
+	if _, ok := o.created[dst]; !ok || !o.resume {
+		return 0, false
+	}
+
+	if device == nil {
+		stat, err := os.Stat(dst)
+		if err != nil || !stat.Mode().IsRegular() {
+			return 0, false
+		}
+
+		partial = stat.Size()
+	} else {
+		stat, err := device.stat(dst)
+		if err != nil || !stat.Mode.IsRegular() {
+			return 0, false
+		}
+
+		partial = stat.Size
+	}
+
+	if partial > size {
+		return 0, false
+	}
+
+	return partial, partial == size
+}
+
+func verifyMove(src, dst string, moved, size int64) error {
+	if moved != size {
+		return fmt.Errorf(
+			"Cannot verify %s: transferred %d bytes to %s, expected %d bytes",
+			src, moved, dst, size,
+		)
+	}
+
+	return nil
+}
+
+func removeAdbFile(path, cmd string, device *adbDevice) error {
+	out, err := device.runCommand(shellJoin(cmd, path))
+	if err != nil {
+		return err
+	} else if out != "" {
+		return errors.New(strings.TrimSpace(out))
+	}
+
 	return nil
 }
 
@@ -230,7 +672,7 @@ func (o *operation) copyFile(src, dst string, entry os.FileInfo, recursive bool)
 	}
 	defer srcFile.Close()
 
-	cioIn := contextio.NewReader(o.ctx, srcFile)
+	cioIn := o.reader(srcFile)
 	prgIn := progressbar.NewReader(cioIn, o.progress.pbar)
 
 	_, err = io.Copy(dstFile, &prgIn)
@@ -238,6 +680,19 @@ func (o *operation) copyFile(src, dst string, entry os.FileInfo, recursive bool)
 		return err
 	}
 
+	if err = dstFile.Close(); err != nil {
+		return err
+	}
+
+	stat, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err = o.setAttributes(dst, stat.Mode(), stat.ModTime(), stat); err != nil {
+		return err
+	}
+
 	o.updatePb()
 
 	return nil
@@ -282,102 +737,101 @@ func (o *operation) copyRecursive(src, dst string) error {
 		d := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
-			if err = o.copyRecursive(s, d); err != nil {
+			if err = o.skipError(s, d, o.copyRecursive(s, d)); err != nil {
 				return err
 			}
 			continue
 		}
 
-		if err = o.copyFile(s, d, entry, true); err != nil {
+		d, err = o.resolveConflict(s, d, false)
+		if err != nil {
+			return err
+		} else if d == "" {
+			continue
+		}
+
+		if err = o.skipError(s, d, o.copyFile(s, d, entry, true)); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return o.setAttributes(dst, stat.Mode(), stat.ModTime(), stat)
 }
 
-func (o *operation) getTotalFiles(src string) error {
-	if o.totalFile > 0 || o.opmode != opCopy {
+func (o *operation) setAttributes(dst string, mode os.FileMode, mtime time.Time, owner os.FileInfo) error {
+	if !o.preserve {
 		return nil
 	}
 
-	if o.transfer == adbToAdb {
-		return nil
+	if err := os.Chmod(dst, mode.Perm()); err != nil {
+		return err
 	}
 
-	if o.transfer == adbToLocal {
-		device, err := getAdb()
-		if err != nil {
-			return err
-		}
+	if err := os.Chtimes(dst, mtime, mtime); err != nil {
+		return err
+	}
 
-		cmd := fmt.Sprintf("find '%s' -type f | wc -l", src)
-		out, err := device.RunCommand(cmd)
-		if err != nil {
-			return err
+	if owner != nil {
+		if st, ok := owner.Sys().(*syscall.Stat_t); ok {
+			os.Lchown(dst, int(st.Uid), int(st.Gid))
 		}
+	}
 
-		o.totalFile, err = strconv.Atoi(strings.TrimSuffix(out, "\n"))
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		cmd = fmt.Sprintf("du -d0 -sh '%s'", src)
-		out, err = device.RunCommand(cmd)
-		if err != nil {
-			return err
-		}
+func (o *operation) getTotalFiles(src string) error {
+	if o.totalFile > 0 || !o.byteProgress() {
+		return nil
+	}
 
-		o.totalBytes, err = getByteSize(strings.Fields(out)[0])
-		if err != nil {
-			return err
-		}
+	if o.plan != nil {
+		statsLock.Lock()
+		o.totalFile, o.totalBytes = o.plan.getSyncTotals()
+		statsLock.Unlock()
 
 		return nil
 	}
 
-	err := filepath.Walk(src, func(p string, entry os.FileInfo, err error) error {
+	if o.transfer != localToAdb && o.transfer != localToLocal {
+		device, err := getDevice(o.srcDev)
 		if err != nil {
 			return err
 		}
 
-		if !entry.IsDir() {
-			o.totalFile++
-			o.totalBytes += entry.Size()
-		}
+		files, bytes, err := device.totalSize(src)
 
-		return nil
-	})
+		statsLock.Lock()
+		o.totalFile, o.totalBytes = files, bytes
+		statsLock.Unlock()
 
-	return err
-}
+		return err
+	}
 
-func getByteSize(str string) (int64, error) {
-	var exp int
-	var err error
-	var size int64
+	var files int
+	var bytes int64
 
-	const unit = 1024
-	const suffixes = "KMGTPE"
+	err := filepath.Walk(src, func(p string, entry os.FileInfo, err error) error {
+		// Unreadable entries are recorded when they are transferred.
+		if err != nil {
+			if o.keepGoing && p != src {
+				return nil
+			}
 
-	num := str[:len(str)-1]
-	suffix := str[len(str)-1:]
+			return err
+		}
 
-	for i := 0; i < len(suffixes); i++ {
-		if string(suffixes[i]) == suffix {
-			exp = i
-			break
+		if !entry.IsDir() {
+			files++
+			bytes += entry.Size()
 		}
-	}
 
-	if strings.Contains(num, ".") {
-		num = strings.Split(num, ".")[0]
-	}
+		return nil
+	})
 
-	size, err = strconv.ParseInt(num, 10, 64)
-	if err != nil {
-		return 0, err
-	}
+	statsLock.Lock()
+	o.totalFile, o.totalBytes = files, bytes
+	statsLock.Unlock()
 
-	return int64(size) * int64(math.Pow(unit, float64(exp+1))), nil
+	return err
 }
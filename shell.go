@@ -0,0 +1,23 @@
+package main
+
+import "strings"
+
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func shellPath(path string) string {
+	if strings.HasPrefix(path, "-") {
+		path = "./" + path
+	}
+
+	return shellQuote(path)
+}
+
+func shellJoin(cmd string, paths ...string) string {
+	for _, path := range paths {
+		cmd += " " + shellPath(path)
+	}
+
+	return cmd
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// printArgs prints each of its arguments followed by a NUL byte.
+const printArgs = `printf '%s\0'`
+
+var shellArgs = []string{
+	"plain",
+	"with space",
+	"Bob's photos",
+	"''",
+	`"double"`,
+	"line\nbreak",
+	"trailing\n",
+	"$(id)",
+	"$HOME",
+	"`id`",
+	`back\slash`,
+	"semi;colon && pipe | amp &",
+	"*.jpg",
+	"~",
+	"-dash",
+	"--",
+	"",
+}
+
+// wrapperScripts stand in for the su and run-as commands on the device.
+// run-as writes the package it is given to the file in $RUNAS_PKG.
+var wrapperScripts = map[string]string{
+	"su": `[ "$1" = -c ] || exit 2
+exec /bin/sh -c "$2"
+`,
+	"run-as": `printf '%s' "$1" >"$RUNAS_PKG"
+shift
+exec "$@"
+`,
+}
+
+// runShell runs a command line with /bin/sh, and returns
+// the arguments printed by the printArgs command in it.
+func runShell(t *testing.T, line string, env ...string) []string {
+	t.Helper()
+
+	cmd := exec.Command("/bin/sh", "-c", line)
+	cmd.Env = append(os.Environ(), env...)
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+
+	args := strings.Split(string(out), "\x00")
+
+	return args[:len(args)-1]
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, arg := range shellArgs {
+		got := runShell(t, printArgs+" "+shellQuote(arg))
+
+		if want := []string{arg}; !reflect.DeepEqual(got, want) {
+			t.Errorf("shellQuote(%q): got %q, want %q", arg, got, want)
+		}
+	}
+}
+
+func TestShellPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/sdcard/a.txt", "'/sdcard/a.txt'"},
+		{"Bob's photos", `'Bob'\''s photos'`},
+		{"-rf", "'./-rf'"},
+		{"--", "'./--'"},
+		{"a-b", "'a-b'"},
+		{"/-dash", "'/-dash'"},
+	}
+
+	for _, test := range tests {
+		if got := shellPath(test.path); got != test.want {
+			t.Errorf("shellPath(%q): got %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	for _, src := range shellArgs {
+		dst := "/sdcard/" + src
+
+		got := runShell(t, shellJoin(printArgs, src, dst))
+
+		want := []string{src, dst}
+		if strings.HasPrefix(src, "-") {
+			want[0] = "./" + src
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("shellJoin(%q, %q): got %q, want %q", src, dst, got, want)
+		}
+	}
+}
+
+func TestShellCmd(t *testing.T) {
+	bin := t.TempDir()
+	pkgFile := filepath.Join(bin, "package")
+
+	for name, script := range wrapperScripts {
+		if err := ioutil.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := []string{
+		"PATH=" + bin + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"RUNAS_PKG=" + pkgFile,
+	}
+
+	tests := []deviceAccess{
+		{},
+		{root: true},
+		{runas: "com.example.app"},
+		{runas: "it's; $(id)"},
+		{root: true, runas: "com.example.app"},
+	}
+
+	for _, access := range tests {
+		device := &adbDevice{deviceAccess: access}
+
+		for _, arg := range shellArgs {
+			os.Remove(pkgFile)
+
+			got := runShell(t, device.shellCmd(shellJoin(printArgs, arg)), env...)
+
+			want := []string{arg}
+			if strings.HasPrefix(arg, "-") {
+				want[0] = "./" + arg
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("shellCmd with %+v, path %q: got %q, want %q", access, arg, got, want)
+			}
+
+			wantPkg := access.runas
+			if access.root {
+				wantPkg = ""
+			}
+
+			if pkg, _ := ioutil.ReadFile(pkgFile); string(pkg) != wantPkg {
+				t.Errorf("shellCmd with %+v: run-as got package %q, want %q", access, pkg, wantPkg)
+			}
+		}
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/darkhz/tview"
-	adb "github.com/zach-klippenstein/goadb"
 )
 
 type message struct {
@@ -211,6 +211,111 @@ func showConfirmMsg(msg string, doFunc, resetFunc func()) {
 	app.SetFocus(input)
 }
 
+func showConflictInput(ctx context.Context, msg string, cancel func(), reply chan<- conflictMode) {
+	var done bool
+
+	actions := map[rune]conflictAction{
+		'o': conflictOverwrite,
+		's': conflictSkip,
+		'r': conflictRename,
+		'n': conflictNewer,
+		'l': conflictLarger,
+	}
+
+	msg += " [o]verwrite, [s]kip, [r]ename, keep [n]ewer, keep [l]arger (uppercase for all):"
+	input := getStatusInput(tview.Escape(msg), true)
+
+	focus := app.GetFocus()
+
+	exit := func() {
+		done = true
+
+		statuspgs.SwitchToPage("statusmsg")
+		app.SetFocus(focus)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		app.QueueUpdateDraw(func() {
+			if !done {
+				exit()
+			}
+		})
+	}()
+
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			exit()
+			cancel()
+
+			return nil
+		}
+
+		key := event.Rune()
+		all := unicode.IsUpper(key)
+
+		action, ok := actions[unicode.ToLower(key)]
+		if !ok {
+			return nil
+		}
+
+		exit()
+		reply <- conflictMode{action, all}
+
+		return nil
+	})
+
+	statuspgs.AddAndSwitchToPage("conflict", input, true)
+	app.SetFocus(input)
+}
+
+func showSyncConfirm(srcPane, dstPane *dirPane) {
+	msg := fmt.Sprintf(
+		"Mirror '%s' to '%s' (compare [y] size/time, [c] checksums, [n] cancel)?",
+		srcPane.getPath(), dstPane.getPath(),
+	)
+
+	input := getStatusInput(tview.Escape(msg), true)
+
+	exit := func() {
+		statuspgs.SwitchToPage("statusmsg")
+		app.SetFocus(prevPane.table)
+	}
+
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			exit()
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'y', 'c':
+			go planSync(srcPane, dstPane, event.Rune() == 'c')
+			fallthrough
+
+		case 'n':
+			exit()
+		}
+
+		return nil
+	})
+
+	statuspgs.AddAndSwitchToPage("confirm", input, true)
+	app.SetFocus(input)
+}
+
+func showSyncPlanInput(srcPane, dstPane *dirPane, plan *syncPlan) {
+	input := getStatusInput("", false)
+
+	syncPlanSelect(input, plan, func() {
+		go startSync(srcPane, dstPane, plan)
+	})
+
+	statuspgs.AddAndSwitchToPage("syncinput", input, true)
+	app.SetFocus(input)
+}
+
 func (p *dirPane) showFilterInput() {
 	var regex bool
 
@@ -235,7 +340,7 @@ func (p *dirPane) showFilterInput() {
 		app.SetFocus(prevPane.table)
 	}
 
-	filter := func(row int, dir *adb.DirEntry) {
+	filter := func(row int, dir *dirEntry) {
 		sel := checkSelected(p.path, dir.Name, false)
 		p.updateDirPane(row, sel, dir)
 	}
@@ -327,7 +432,7 @@ func showMkdirRenameInput(selPane, auxPane *dirPane, key rune) {
 		return
 	}
 
-	origname := ref.(*adb.DirEntry).Name
+	origname := ref.(*dirEntry).Name
 
 	switch key {
 	case 'M':
@@ -392,6 +497,126 @@ func showMkdirRenameInput(selPane, auxPane *dirPane, key rune) {
 	app.SetFocus(input)
 }
 
+func showConnectInput() {
+	var pair bool
+	var address string
+	var histpos int
+
+	endpoints := loadEndpoints()
+	histpos = len(endpoints)
+
+	input := getStatusInput("", false)
+
+	inputlabel := func() {
+		var label string
+
+		switch {
+		case pair && address != "":
+			label = "Pairing code:"
+
+		case pair:
+			label = "Pair with (host:port):"
+
+		default:
+			label = "Connect to (host:port):"
+		}
+
+		input.SetLabel("[::b]" + label + " ")
+	}
+
+	exit := func() {
+		statuspgs.SwitchToPage("statusmsg")
+		app.SetFocus(prevPane.table)
+	}
+
+	history := func(key tcell.Key) {
+		if len(endpoints) == 0 || address != "" {
+			return
+		}
+
+		switch key {
+		case tcell.KeyUp:
+			if histpos > 0 {
+				histpos--
+			}
+
+		case tcell.KeyDown:
+			if histpos < len(endpoints)-1 {
+				histpos++
+			}
+		}
+
+		input.SetText(endpoints[histpos])
+	}
+
+	connect := func(text string) {
+		if !pair {
+			showInfoMsg("Connecting to " + text)
+
+			endpoint, err := connectDevice(text)
+			if err != nil {
+				showErrorMsg(err, false)
+				return
+			}
+
+			showInfoMsg("Connected to " + endpoint + ", press D to select it")
+
+			return
+		}
+
+		showInfoMsg("Pairing with " + address)
+
+		endpoint, err := pairDevice(address, text)
+		if err != nil {
+			showErrorMsg(err, false)
+			return
+		}
+
+		showInfoMsg("Paired with " + endpoint + ", connect to its debugging port")
+	}
+
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyCtrlP:
+			if address == "" {
+				pair = !pair
+				inputlabel()
+			}
+
+		case tcell.KeyUp, tcell.KeyDown:
+			history(event.Key())
+			return nil
+
+		case tcell.KeyEnter:
+			text := input.GetText()
+			if text == "" {
+				return nil
+			}
+
+			if pair && address == "" {
+				address = text
+				input.SetText("")
+				inputlabel()
+
+				return nil
+			}
+
+			go connect(text)
+			fallthrough
+
+		case tcell.KeyEscape:
+			exit()
+		}
+
+		return event
+	})
+
+	inputlabel()
+
+	statuspgs.AddAndSwitchToPage("connect", input, true)
+	app.SetFocus(input)
+}
+
 func (p *dirPane) showSortDirInput() {
 	input := getStatusInput("", true)
 
@@ -480,6 +705,28 @@ func (p *dirPane) showChangeDirInput() {
 	app.SetFocus(input)
 }
 
+func (p *dirPane) showDeviceInput() {
+	input := getStatusInput("Select device:", false)
+
+	if !deviceSelect(p, input) {
+		return
+	}
+
+	statuspgs.AddAndSwitchToPage("devinput", input, true)
+	app.SetFocus(input)
+}
+
+func (p *dirPane) showPackageInput() {
+	input := getStatusInput("Run as package:", false)
+
+	if !packageSelect(p, input) {
+		return
+	}
+
+	statuspgs.AddAndSwitchToPage("pkginput", input, true)
+	app.SetFocus(input)
+}
+
 func showEditSelections(sinput *tview.InputField) {
 	input := getStatusInput("Filter selections:", false)
 
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type syncAction int
+
+const (
+	syncAdd syncAction = iota
+	syncUpdate
+	syncDelete
+)
+
+type syncSide struct {
+	path   string
+	mode   ifaceMode
+	access deviceAccess
+	device *adbDevice
+}
+
+type syncItem struct {
+	action syncAction
+	path   string
+	entry  *dirEntry
+	skip   bool
+}
+
+type syncPlan struct {
+	src   syncSide
+	dst   syncSide
+	items []*syncItem
+}
+
+const syncChecksumBatch = 64
+
+func (a syncAction) String() string {
+	actstr := [...]string{
+		"Add",
+		"Update",
+		"Delete",
+	}
+
+	return actstr[a]
+}
+
+func newSyncSide(p *dirPane) (syncSide, error) {
+	side := syncSide{
+		path:   p.getPath(),
+		mode:   p.mode,
+		access: p.deviceAccess,
+	}
+
+	if side.mode == mAdb {
+		device, err := getDevice(side.access)
+		if err != nil {
+			return side, err
+		}
+
+		side.device = device
+	}
+
+	return side, nil
+}
+
+//gocyclo:ignore
+func buildSyncPlan(src, dst syncSide, checksum bool) (*syncPlan, error) {
+	var updates []string
+
+	plan := &syncPlan{src: src, dst: dst}
+
+	srcEntries, err := src.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	dstEntries, err := dst.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]struct{})
+
+	for _, rel := range sortedPaths(dstEntries) {
+		entry := dstEntries[rel]
+
+		if parentDeleted(rel, deleted) {
+			continue
+		}
+
+		sentry, ok := srcEntries[rel]
+		if ok && (sentry.Mode&os.ModeSymlink != 0 || sentry.Mode.IsDir() == entry.Mode.IsDir()) {
+			continue
+		}
+
+		deleted[rel] = struct{}{}
+		plan.items = append(plan.items, &syncItem{action: syncDelete, path: rel, entry: entry})
+	}
+
+	for _, rel := range sortedPaths(srcEntries) {
+		entry := srcEntries[rel]
+
+		if !entry.Mode.IsDir() && !entry.Mode.IsRegular() {
+			continue
+		}
+
+		dentry, ok := dstEntries[rel]
+		if _, del := deleted[rel]; !ok || del {
+			plan.items = append(plan.items, &syncItem{action: syncAdd, path: rel, entry: entry})
+			continue
+		}
+
+		switch {
+		case entry.Mode.IsDir():
+			continue
+
+		case entry.Size != dentry.Size:
+			plan.items = append(plan.items, &syncItem{action: syncUpdate, path: rel, entry: entry})
+
+		case checksum:
+			updates = append(updates, rel)
+
+		case entry.ModifiedAt.Unix() > dentry.ModifiedAt.Unix():
+			plan.items = append(plan.items, &syncItem{action: syncUpdate, path: rel, entry: entry})
+		}
+	}
+
+	if updates == nil {
+		return plan, nil
+	}
+
+	srcSums, err := src.checksums(updates)
+	if err != nil {
+		return nil, err
+	}
+
+	dstSums, err := dst.checksums(updates)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range updates {
+		if sum, ok := srcSums[rel]; ok && sum == dstSums[rel] {
+			continue
+		}
+
+		plan.items = append(plan.items, &syncItem{action: syncUpdate, path: rel, entry: srcEntries[rel]})
+	}
+
+	return plan, nil
+}
+
+func (s syncSide) walk() (map[string]*dirEntry, error) {
+	entries := make(map[string]*dirEntry)
+
+	if s.mode == mAdb {
+		return entries, s.walkAdb("", entries)
+	}
+
+	err := filepath.Walk(s.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == s.path {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.path, path)
+		if err != nil {
+			return err
+		}
+
+		entries[rel] = newLocalEntry(info)
+
+		return nil
+	})
+
+	return entries, err
+}
+
+func (s syncSide) walkAdb(rel string, entries map[string]*dirEntry) error {
+	list, err := s.device.listDir(filepath.Join(s.path, rel))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range list {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		path := filepath.Join(rel, entry.Name)
+		entries[path] = entry
+
+		if entry.Mode.IsDir() {
+			if err := s.walkAdb(path, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s syncSide) checksums(paths []string) (map[string]string, error) {
+	sums := make(map[string]string)
+
+	if s.mode == mLocal {
+		for _, rel := range paths {
+			sum, err := localChecksum(filepath.Join(s.path, rel))
+			if err != nil {
+				return nil, err
+			}
+
+			sums[rel] = sum
+		}
+
+		return sums, nil
+	}
+
+	for i := 0; i < len(paths); i += syncChecksumBatch {
+		end := i + syncChecksumBatch
+		if end > len(paths) {
+			end = len(paths)
+		}
+
+		cmd := shellJoin("cd", s.path) + " && " + shellJoin("md5sum", paths[i:end]...)
+
+		out, err := s.device.runCommand(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.SplitN(strings.TrimRight(line, "\r"), "  ", 2)
+			if len(fields) != 2 || len(fields[0]) != 32 {
+				continue
+			}
+
+			sums[strings.TrimPrefix(fields[1], "./")] = fields[0]
+		}
+	}
+
+	return sums, nil
+}
+
+func localChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s syncSide) join(rel string) string {
+	return filepath.Join(s.path, rel)
+}
+
+func (p *syncPlan) counts() (int, int, int) {
+	var add, update, del int
+
+	for _, item := range p.items {
+		if item.skip {
+			continue
+		}
+
+		switch item.action {
+		case syncAdd:
+			add++
+
+		case syncUpdate:
+			update++
+
+		case syncDelete:
+			del++
+		}
+	}
+
+	return add, update, del
+}
+
+// setSkip sets whether an item is skipped. The items within an added
+// directory are skipped along with it, and the added directories which
+// contain an item that is not skipped are not skipped either.
+func (p *syncPlan) setSkip(item *syncItem, skip bool) {
+	item.skip = skip
+
+	for _, other := range p.items {
+		if other == item {
+			continue
+		}
+
+		switch {
+		case item.action == syncAdd && item.entry.Mode.IsDir() && isSubPath(other.path, item.path):
+			other.skip = skip
+
+		case !skip && other.action == syncAdd && isSubPath(item.path, other.path):
+			other.skip = false
+		}
+	}
+}
+
+func (p *syncPlan) String() string {
+	add, update, del := p.counts()
+
+	return fmt.Sprintf("%d to add, %d to update, %d to delete", add, update, del)
+}
+
+func (i *syncItem) String() string {
+	text := i.action.String() + " " + i.path
+
+	if i.entry.Mode.IsDir() {
+		text += "/"
+	} else if i.action != syncDelete {
+		text += " (" + getSizeString(i.entry.Size) + ")"
+	}
+
+	return text
+}
+
+func planSync(srcPane, dstPane *dirPane, checksum bool) {
+	showInfoMsg("Comparing directories..")
+
+	src, err := newSyncSide(srcPane)
+	if err != nil {
+		showErrorMsg(err, false)
+		return
+	}
+
+	dst, err := newSyncSide(dstPane)
+	if err != nil {
+		showErrorMsg(err, false)
+		return
+	}
+
+	plan, err := buildSyncPlan(src, dst, checksum)
+	if err != nil {
+		showErrorMsg(err, false)
+		return
+	}
+
+	if plan.items == nil {
+		showInfoMsg("Directories are already in sync")
+		return
+	}
+
+	app.QueueUpdateDraw(func() {
+		showSyncPlanInput(srcPane, dstPane, plan)
+	})
+}
+
+func startSync(srcPane, dstPane *dirPane, plan *syncPlan) {
+	op := newOperation(opSync)
+
+	op.srcDev = plan.src.access
+	op.dstDev = plan.dst.access
+	op.transfer = transfermode(opCopy, plan.src.mode, plan.dst.mode, op.srcDev.serial, op.dstDev.serial)
+	op.plan = plan
+
+	var devices []string
+	for _, side := range []syncSide{plan.src, plan.dst} {
+		if side.mode == mAdb {
+			devices = append(devices, side.access.serial)
+		}
+	}
+
+	src, dst := plan.src.path, plan.dst.path
+
+	err := op.startJob(op.describe(src, filepath.Join(dst, filepath.Base(src))), devices...)
+	if err == nil {
+		err = op.setNewProgress(src, filepath.Join(dst, filepath.Base(src)), 0, 1)
+	}
+	if err == nil {
+		err = addOpsPath(src, dst)
+		if err == nil {
+			err = op.runSync(plan)
+			rmOpsPath(src, dst)
+		}
+	}
+
+	op.opSetStatus(opDone, err)
+
+	for _, pane := range []*dirPane{srcPane, dstPane} {
+		if pane.mode == plan.dst.mode && pane.serial == plan.dst.access.serial &&
+			strings.HasPrefix(pane.getPath(), dst) {
+			pane.ChangeDir(false, false)
+		}
+	}
+}
+
+func (p *syncPlan) getSyncTotals() (int, int64) {
+	var files int
+	var bytes int64
+
+	for _, item := range p.items {
+		if item.skip || item.action == syncDelete || item.entry.Mode.IsDir() {
+			continue
+		}
+
+		files++
+		bytes += item.entry.Size
+	}
+
+	return files, bytes
+}
+
+//gocyclo:ignore
+func (o *operation) runSync(plan *syncPlan) error {
+	srcDevice, dstDevice := plan.src.device, plan.dst.device
+
+	for _, item := range plan.items {
+		select {
+		case <-o.ctx.Done():
+			return o.ctx.Err()
+
+		default:
+		}
+
+		if item.skip {
+			continue
+		}
+
+		var err error
+
+		src, dst := plan.src.join(item.path), plan.dst.join(item.path)
+
+		switch {
+		case item.action == syncDelete && plan.dst.mode == mLocal:
+			err = os.RemoveAll(dst)
+
+		case item.action == syncDelete:
+			err = removeAdbFile(dst, "rm -rf", dstDevice)
+
+		case item.entry.Mode.IsDir() && plan.dst.mode == mLocal:
+			err = os.MkdirAll(dst, item.entry.Mode.Perm())
+
+		case item.entry.Mode.IsDir():
+			err = makeAdbDir(dst, item.entry.Mode, dstDevice)
+
+		default:
+			err = o.syncFile(src, dst, item.entry, srcDevice, dstDevice)
+		}
+
+		// Deletions are not retried.
+		if item.action == syncDelete {
+			src = ""
+		}
+
+		if err = o.skipError(src, dst, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *operation) syncFile(src, dst string, entry *dirEntry, srcDevice, dstDevice *adbDevice) error {
+	switch o.transfer {
+	case localToLocal, localToAdb:
+		info, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+
+		if o.transfer == localToAdb {
+			return o.pushFile(src, dst, info, dstDevice, true)
+		}
+
+		return o.copyFile(src, dst, info, true)
+
+	case adbToLocal:
+		return o.pullFile(src, dst, entry, srcDevice, true)
+	}
+
+	return o.transferFile(src, dst, entry, srcDevice, dstDevice)
+}
+
+func sortedPaths(entries map[string]*dirEntry) []string {
+	paths := make([]string, 0, len(entries))
+
+	for path := range entries {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func isSubPath(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func parentDeleted(rel string, deleted map[string]struct{}) bool {
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if _, ok := deleted[dir]; ok {
+			return true
+		}
+	}
+
+	return false
+}
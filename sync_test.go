@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsSubPath(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/sdcard/DCIM", "/sdcard/DCIM", true},
+		{"/sdcard/DCIM/Camera", "/sdcard/DCIM", true},
+		{"/sdcard/DCIM/", "/sdcard/DCIM", true},
+		{"/sdcard/DCIM2", "/sdcard/DCIM", false},
+		{"/sdcard", "/sdcard/DCIM", false},
+		{"/sdcard/..DCIM", "/sdcard", true},
+		{"a/b", "a", true},
+		{"ab", "a", false},
+	}
+
+	for _, test := range tests {
+		if got := isSubPath(test.path, test.dir); got != test.want {
+			t.Errorf("isSubPath(%q, %q): got %v, want %v", test.path, test.dir, got, test.want)
+		}
+	}
+}
+
+func TestSyncPlanSkip(t *testing.T) {
+	dir := &dirEntry{Mode: os.ModeDir | 0755}
+	file := &dirEntry{Mode: 0644, Size: 10}
+
+	plan := &syncPlan{items: []*syncItem{
+		{action: syncAdd, path: "a", entry: dir},
+		{action: syncAdd, path: "a/b", entry: dir},
+		{action: syncAdd, path: "a/b/c.txt", entry: file},
+		{action: syncAdd, path: "a2.txt", entry: file},
+		{action: syncUpdate, path: "u.txt", entry: file},
+		{action: syncDelete, path: "old", entry: dir},
+	}}
+
+	skipped := func() []bool {
+		var skips []bool
+		for _, item := range plan.items {
+			skips = append(skips, item.skip)
+		}
+
+		return skips
+	}
+
+	check := func(step string, want ...bool) {
+		t.Helper()
+
+		got := skipped()
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: %s skip is %v, want %v", step, plan.items[i].path, got[i], want[i])
+			}
+		}
+	}
+
+	plan.setSkip(plan.items[0], true)
+	check("skip a", true, true, true, false, false, false)
+
+	if files, bytes := plan.getSyncTotals(); files != 2 || bytes != 20 {
+		t.Errorf("skip a: totals are %d files, %d bytes", files, bytes)
+	}
+
+	plan.setSkip(plan.items[2], false)
+	check("keep a/b/c.txt", false, false, false, false, false, false)
+
+	plan.setSkip(plan.items[1], true)
+	check("skip a/b", false, true, true, false, false, false)
+
+	plan.setSkip(plan.items[1], false)
+	check("keep a/b", false, false, false, false, false, false)
+
+	plan.setSkip(plan.items[5], true)
+	check("skip old", false, false, false, false, false, true)
+}
+
+// TestSyncSkippedDir checks that the contents of an added
+// directory are not copied, if the directory is skipped.
+func TestSyncSkippedDir(t *testing.T) {
+	startTestUI(t)
+
+	device := newFakeAdb(t)
+	local := t.TempDir()
+
+	writeTree(t, local, testTree)
+	writeTree(t, local, map[string]string{"kept.txt": "kept"})
+
+	if err := os.MkdirAll(device.path("/sdcard/sync"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	srcPane, dstPane := newTestPane(mLocal, local), newTestPane(mAdb, "/sdcard/sync")
+
+	src, err := newSyncSide(srcPane)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := newSyncSide(dstPane)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := buildSyncPlan(src, dst, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range plan.items {
+		if item.path == "dir" {
+			plan.setSkip(item, true)
+		}
+	}
+
+	startSync(srcPane, dstPane, plan)
+	device.settle()
+
+	checkTree(t, device.path("/sdcard/sync"), map[string]string{"kept.txt": "kept"})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dolmen-go/contextio"
+	"github.com/schollz/progressbar/v3"
+)
+
+const (
+	tarMinFiles   = 200
+	tarMaxAverage = 512 * 1024
+)
+
+var tarMode string
+
+func (o *operation) useTar(src, dst string, device *adbDevice) bool {
+	if o.opmode != opCopy || o.verify || o.resume || tarMode == "never" {
+		return false
+	}
+
+	stat, err := o.statPath(src, true)
+	if err != nil || !stat.Mode.IsDir() {
+		return false
+	}
+
+	// Files in an existing directory must be checked for conflicts.
+	if _, err := o.statPath(dst, false); err == nil &&
+		!(o.conflict.all && o.conflict.action == conflictOverwrite) {
+		return false
+	}
+
+	if tarMode != "always" {
+		if o.totalFile < tarMinFiles || o.totalBytes/int64(o.totalFile) >= tarMaxAverage {
+			return false
+		}
+	}
+
+	out, err := device.runCommand("command -v tar")
+	if err != nil || strings.TrimSpace(out) == "" {
+		return false
+	}
+
+	return true
+}
+
+//gocyclo:ignore
+func (o *operation) pullTar(src, dst string, device *adbDevice) error {
+	var dirs []*tar.Header
+
+	src = filepath.Clean(src)
+	dst = filepath.Clean(dst)
+	base := filepath.Base(src)
+
+	// The exit status of tar follows the archive, since its errors would
+	// otherwise go unnoticed, and stderr would be mixed into the archive.
+	cmd := shellJoin("tar -cf - -C", filepath.Dir(src), base) + " 2>/dev/null; echo $?"
+
+	stream, err := device.execOut(cmd)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	reader := tar.NewReader(o.reader(stream))
+
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		path, err := tarPath(dst, base, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if isSymlink(path) {
+				return fmt.Errorf("%s: Path in archive is a symlink", hdr.Name)
+			}
+
+			if err := os.MkdirAll(path, mode.Perm()|0700); err != nil {
+				return err
+			}
+
+			dirs = append(dirs, hdr)
+			continue
+
+		case tar.TypeSymlink:
+			os.Remove(path)
+			err = os.Symlink(hdr.Linkname, path)
+
+		case tar.TypeLink:
+			var target string
+
+			target, err = tarPath(dst, base, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+
+			os.Remove(path)
+			err = os.Link(target, path)
+
+		case tar.TypeReg, tar.TypeRegA:
+			err = o.extractFile(path, hdr, reader)
+
+		default:
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	rest, err := ioutil.ReadAll(contextio.NewReader(o.ctx, stream))
+	if err != nil {
+		return err
+	}
+
+	if status := strings.TrimSpace(strings.Trim(string(rest), "\x00")); status != "0" {
+		if status == "" {
+			return fmt.Errorf("%s: Archive is incomplete", src)
+		}
+
+		return fmt.Errorf("%s: Archive failed with status %s", src, status)
+	}
+
+	// Directory attributes are set last, since extracting
+	// files into them changes their modification times.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path, err := tarPath(dst, base, dirs[i].Name)
+		if err != nil {
+			return err
+		}
+
+		if isSymlink(path) {
+			return fmt.Errorf("%s: Path in archive is a symlink", dirs[i].Name)
+		}
+
+		if err := o.setAttributes(path, dirs[i].FileInfo().Mode(), dirs[i].ModTime, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tarPath(dst, base, name string) (string, error) {
+	rel, err := filepath.Rel(base, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: Invalid path in archive", name)
+	}
+
+	path := filepath.Join(dst, rel)
+
+	// Nothing is extracted through a symlink, which may point outside dst.
+	for dir := filepath.Dir(path); dir != dst && strings.HasPrefix(dir, dst); dir = filepath.Dir(dir) {
+		if isSymlink(dir) {
+			return "", fmt.Errorf("%s: Path in archive is under a symlink", name)
+		}
+	}
+
+	return path, nil
+}
+
+func isSymlink(path string) bool {
+	stat, err := os.Lstat(path)
+
+	return err == nil && stat.Mode()&os.ModeSymlink != 0
+}
+
+func (o *operation) extractFile(path string, hdr *tar.Header, reader io.Reader) error {
+	os.Remove(path)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+
+	o.created[path] = struct{}{}
+
+	prgIn := progressbar.NewReader(reader, o.progress.pbar)
+
+	_, err = io.Copy(file, &prgIn)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if err = o.setAttributes(path, hdr.FileInfo().Mode(), hdr.ModTime, nil); err != nil {
+		return err
+	}
+
+	o.updatePb()
+
+	return nil
+}
+
+func (o *operation) pushTar(src, dst string, device *adbDevice) error {
+	src = filepath.Clean(src)
+	dst = filepath.Clean(dst)
+
+	// The archive carries no owners, so as root, files are extracted
+	// as the current user instead of being owned by root.
+	opts := "-xf -"
+	if device.root {
+		opts += " -o"
+	}
+
+	cmd := shellJoin("tar "+opts+" -C", filepath.Dir(dst))
+
+	conn, err := device.execConn(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	writer := tar.NewWriter(conn)
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-o.ctx.Done():
+			return o.ctx.Err()
+
+		default:
+		}
+
+		return o.archiveFile(writer, src, dst, path, info)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err = tcp.CloseWrite(); err != nil {
+			return err
+		}
+	}
+
+	out, err := ioutil.ReadAll(contextio.NewReader(o.ctx, conn))
+	if err != nil {
+		return err
+	} else if len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (o *operation) archiveFile(writer *tar.Writer, src, dst, path string, info os.FileInfo) error {
+	var link string
+
+	mode := info.Mode()
+
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		link = target
+
+	case !mode.IsDir() && !mode.IsRegular():
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(src, path)
+	if err != nil {
+		return err
+	}
+
+	// Local owners have no meaning on the device.
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.Uid, hdr.Gid = 0, 0
+
+	hdr.Name = filepath.Join(filepath.Base(dst), rel)
+	if mode.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := writer.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	prgIn := progressbar.NewReader(o.reader(file), o.progress.pbar)
+
+	if _, err := io.Copy(writer, &prgIn); err != nil {
+		return err
+	}
+
+	o.updatePb()
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type tarEntry struct {
+	name, link, data string
+	typeflag         byte
+}
+
+func TestTarPath(t *testing.T) {
+	root := t.TempDir()
+	dst := filepath.Join(root, "dir")
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(root, filepath.Join(dst, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"dir", dst},
+		{"dir/", dst},
+		{"dir/a.txt", dst + "/a.txt"},
+		{"dir/sub/../b.txt", dst + "/b.txt"},
+		{"dir/..x", dst + "/..x"},
+		{"dir/link", dst + "/link"},
+		{"../x", ""},
+		{"dir/../../x", ""},
+		{"dir/..", ""},
+		{"other/x", ""},
+		{"/etc/passwd", ""},
+		{dst + "/a.txt", ""},
+		{"dir/link/x", ""},
+		{"dir/link/sub/x", ""},
+	}
+
+	for _, test := range tests {
+		got, err := tarPath(dst, "dir", test.name)
+
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("tarPath(%q): got %s, want an error", test.name, got)
+
+		case test.want != "" && (err != nil || got != test.want):
+			t.Errorf("tarPath(%q): got %q, %v, want %s", test.name, got, err, test.want)
+		}
+	}
+}
+
+func makeArchive(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := tar.NewWriter(&buf)
+
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Name:     entry.name,
+			Linkname: entry.link,
+			Typeflag: entry.typeflag,
+			Mode:     0644,
+			Size:     int64(len(entry.data)),
+			ModTime:  time.Now(),
+		}
+
+		if entry.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+
+		if err := writer.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := writer.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// TestPullTar pulls archives which try to write outside the
+// destination, and checks that nothing is written there.
+func TestPullTar(t *testing.T) {
+	startTestUI(t)
+
+	mode := tarMode
+	tarMode = "always"
+	defer func() { tarMode = mode }()
+
+	dir := tarEntry{name: "dir/", typeflag: tar.TypeDir}
+
+	tests := []struct {
+		name    string
+		entries func(outside string) []tarEntry
+		status  int
+	}{
+		{"parent", func(outside string) []tarEntry {
+			return []tarEntry{dir, {name: "../x", data: "x", typeflag: tar.TypeReg}}
+		}, 0},
+		{"nested parent", func(outside string) []tarEntry {
+			return []tarEntry{dir, {name: "dir/../../x", data: "x", typeflag: tar.TypeReg}}
+		}, 0},
+		{"absolute", func(outside string) []tarEntry {
+			return []tarEntry{dir, {name: outside + "/x", data: "x", typeflag: tar.TypeReg}}
+		}, 0},
+		{"under symlink", func(outside string) []tarEntry {
+			return []tarEntry{
+				dir,
+				{name: "dir/link", link: outside, typeflag: tar.TypeSymlink},
+				{name: "dir/link/x", data: "x", typeflag: tar.TypeReg},
+			}
+		}, 0},
+		{"hardlink outside", func(outside string) []tarEntry {
+			return []tarEntry{dir, {name: "dir/secret", link: outside + "/secret", typeflag: tar.TypeLink}}
+		}, 0},
+		{"relative hardlink outside", func(outside string) []tarEntry {
+			return []tarEntry{dir, {name: "dir/secret", link: "../outside/secret", typeflag: tar.TypeLink}}
+		}, 0},
+		{"tar failed", func(outside string) []tarEntry {
+			return []tarEntry{dir}
+		}, 2},
+	}
+
+	for _, test := range tests {
+		device := newFakeAdb(t)
+		root := t.TempDir()
+		outside := filepath.Join(root, "outside")
+
+		writeTree(t, device.path("/sdcard"), testTree)
+		writeTree(t, outside, map[string]string{"secret": "secret"})
+
+		if err := os.MkdirAll(filepath.Join(root, "copy"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		device.setArchive("/sdcard/dir", makeArchive(t, test.entries(outside)), test.status)
+
+		srcPane, dstPane := newTestPane(mAdb, "/sdcard"), newTestPane(mLocal, filepath.Join(root, "copy"))
+
+		_, err := startOperation(srcPane, dstPane, opCopy, false, []selection{{
+			path:   "/sdcard/dir",
+			smode:  mAdb,
+			access: srcPane.deviceAccess,
+		}})
+		if err == nil {
+			t.Errorf("%s: pull succeeded", test.name)
+		}
+
+		checkTree(t, root, map[string]string{"outside/secret": "secret"})
+	}
+}
+
+func TestPullTarTree(t *testing.T) {
+	startTestUI(t)
+
+	mode := tarMode
+	tarMode = "always"
+	defer func() { tarMode = mode }()
+
+	device := newFakeAdb(t)
+	local := t.TempDir()
+
+	writeTree(t, device.path("/sdcard"), testTree)
+
+	runTestOp(t, opCopy, newTestPane(mAdb, "/sdcard"), newTestPane(mLocal, local), "dir")
+
+	checkTree(t, local, testTree)
+}
@@ -1,16 +1,28 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/darkhz/tview"
 	"github.com/gdamore/tcell/v2"
-	adb "github.com/zach-klippenstein/goadb"
 	"golang.org/x/sync/semaphore"
 )
 
+type dirEntry struct {
+	Name       string
+	Mode       os.FileMode
+	Size       int64
+	ModifiedAt time.Time
+
+	// LinkTarget and LinkDir are set only for symlinks.
+	LinkTarget string
+	LinkDir    bool
+}
+
 type dirPane struct {
 	row        int
 	path       string
@@ -19,13 +31,16 @@ type dirPane struct {
 	finput     string
 	filter     bool
 	hidden     bool
+	offline    bool
 	mode       ifaceMode
 	table      *tview.Table
 	plock      *semaphore.Weighted
-	entry      *adb.DirEntry
-	pathList   []*adb.DirEntry
+	entry      *dirEntry
+	pathList   []*dirEntry
 	title      *tview.TextView
 	sortMethod sortData
+
+	deviceAccess
 }
 
 var (
@@ -36,8 +51,11 @@ var (
 	auxPane  *dirPane
 	prevPane *dirPane
 
-	paneToggle   bool
-	layoutToggle bool
+	paneToggle     bool
+	layoutToggle   bool
+	preserveToggle bool
+	verifyToggle   bool
+	continueToggle bool
 
 	panes          *tview.Flex
 	titleBar       *tview.Flex
@@ -73,6 +91,8 @@ func newDirPane(selpane bool) *dirPane {
 		title:  tview.NewTextView(),
 		plock:  semaphore.NewWeighted(1),
 		hidden: true,
+
+		deviceAccess: deviceAccess{serial: initSerial},
 	}
 }
 
@@ -85,6 +105,8 @@ func setupUI() {
 
 	pages.SwitchToPage("main")
 
+	startDeviceWatcher()
+
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyCtrlC:
@@ -235,9 +257,36 @@ func setupOpsView() *tview.Flex {
 		row, _ := opsView.GetSelection()
 		ref := opsView.GetCell(row, 0).GetReference()
 
+		if ref == nil {
+			return
+		}
+
+		op := ref.(*operation)
+		if op.done {
+			op.dismissOps()
+			return
+		}
+
+		op.cancelOps()
+	}
+
+	retrytask := func() {
+		row, _ := opsView.GetSelection()
+		ref := opsView.GetCell(row, 0).GetReference()
+
 		if ref != nil {
-			ref.(*operation).cancelOps()
+			ref.(*operation).retryJob()
+		}
+	}
+
+	selectedOp := func() *operation {
+		row, _ := opsView.GetSelection()
+
+		if ref := opsView.GetCell(row, 0).GetReference(); ref != nil {
+			return ref.(*operation)
 		}
+
+		return nil
 	}
 
 	opsView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -250,9 +299,30 @@ func setupOpsView() *tview.Flex {
 		case 'x':
 			canceltask()
 
+		case 'r':
+			retrytask()
+
 		case 'X':
 			cancelAllOps()
 
+		case 'c':
+			dismissFinishedOps()
+
+		case 'e':
+			if op := selectedOp(); op != nil {
+				op.showErrors()
+			}
+
+		case 'p':
+			if op := selectedOp(); op != nil {
+				op.togglePause()
+			}
+
+		case '[', ']':
+			if op := selectedOp(); op != nil {
+				op.moveQueued(event.Rune() == '[')
+			}
+
 		case 'o':
 			exit()
 
@@ -329,9 +399,33 @@ func setupPane(selPane, auxPane *dirPane) {
 			selPane.showChangeDirInput()
 			return nil
 
+		case 'D':
+			selPane.showDeviceInput()
+			return nil
+
+		case 'C':
+			showConnectInput()
+			return nil
+
+		case '#':
+			selPane.rootSwitchHandler()
+
+		case '@':
+			selPane.showPackageInput()
+			return nil
+
 		case 'r':
 			selPane.ChangeDir(false, false)
 
+		case 't':
+			preserveSwitchHandler()
+
+		case 'v':
+			verifySwitchHandler()
+
+		case 'e':
+			continueSwitchHandler()
+
 		case 'S':
 			showEditSelections(nil)
 
@@ -350,6 +444,10 @@ func setupPane(selPane, auxPane *dirPane) {
 		case 'm', 'p', 'P', 'd':
 			opsHandler(selPane, auxPane, event.Rune())
 
+		case '=':
+			syncHandler(selPane, auxPane)
+			return nil
+
 		case 'M', 'R':
 			showMkdirRenameInput(selPane, auxPane, event.Rune())
 		}
@@ -421,7 +519,7 @@ func paneswitch(selPane, auxPane *dirPane) {
 
 func reset(selPane, auxPane *dirPane) {
 	selected = false
-	multiselection = make(map[string]ifaceMode)
+	multiselection = make(map[string]selection)
 
 	selPane.table.SetSelectable(false, false)
 	selPane.reselect(true)
@@ -558,7 +656,7 @@ func (p *dirPane) reselect(force bool) {
 				continue
 			}
 
-			dir := ref.(*adb.DirEntry)
+			dir := ref.(*dirEntry)
 
 			checksel := checkSelected(p.path, dir.Name, false)
 			p.updateDirPane(row, checksel, dir)
@@ -576,7 +674,7 @@ func (p *dirPane) reselect(force bool) {
 	p.table.Select(pos, 0)
 }
 
-func (p *dirPane) updateDirPane(row int, sel bool, dir *adb.DirEntry) {
+func (p *dirPane) updateDirPane(row int, sel bool, dir *dirEntry) {
 	entry := getListEntry(dir)
 
 	for col, dname := range entry {
@@ -589,6 +687,10 @@ func (p *dirPane) updateDirPane(row int, sel bool, dir *adb.DirEntry) {
 			if len(dname) > 0 && mode {
 				dname += "/"
 			}
+
+			if layoutToggle && dir.LinkTarget != "" {
+				dname += " -> " + dir.LinkTarget
+			}
 		}
 
 		color, attr := setEntryColor(col, sel, entry[1])
@@ -607,7 +709,7 @@ func (p *dirPane) updateDirPane(row int, sel bool, dir *adb.DirEntry) {
 				Attributes(tcell.AttrBold))
 		} else {
 			_, _, w, _ := pages.GetRect()
-			cell.SetMaxWidth(w - 40)
+			cell.SetMaxWidth(w - 50)
 		}
 
 		p.table.SetCell(row, col, cell.SetTextColor(color).
@@ -622,7 +724,7 @@ func (p *dirPane) updateRef(lock bool) {
 		ref := p.table.GetCell(p.row, 0).GetReference()
 
 		if ref != nil {
-			p.entry = ref.(*adb.DirEntry)
+			p.entry = ref.(*dirEntry)
 		} else {
 			p.entry = nil
 		}
@@ -644,9 +746,23 @@ func (p *dirPane) setPaneTitle() {
 	switch p.mode {
 	case mAdb:
 		prefix = "Adb"
+		if p.serial != "" {
+			prefix += " (" + tview.Escape(p.serial) + ")"
+		}
+
+		if p.root {
+			prefix += " [red::bu]#root[-::bu]"
+		}
+
+		if p.runas != "" {
+			prefix += " [green::bu]@" + tview.Escape(p.runas) + "[-::bu]"
+		}
 
 	case mLocal:
 		prefix = "Local"
+		if p.offline {
+			prefix += " (" + tview.Escape(p.serial) + " offline)"
+		}
 	}
 
 	switch {
@@ -711,11 +827,14 @@ func (p *dirPane) getLock() bool {
 	return p.plock.TryAcquire(1)
 }
 
+func (p *dirPane) waitLock() {
+	p.plock.Acquire(context.Background(), 1)
+}
+
 func stopApp() {
 	quitmsg := "Quit"
 
-	istask := opsView.GetRowCount()
-	if istask > 0 {
+	if opsRunning > 0 {
 		quitmsg += " (jobs are still running)"
 	}
 
@@ -729,6 +848,7 @@ func stopApp() {
 func stopUI() {
 	app.Stop()
 	stopStatus()
+	stopDeviceWatcher()
 	cancelAllOps()
 }
 
@@ -746,12 +866,21 @@ func showHelp() {
 		"Switch to operations page ":            "o",
 		"Switch between ADB/Local ":             "s, <",
 		"Change to any directory ":              "g, >",
+		"Select ADB device ":                    "D",
+		"Connect/pair wireless ADB device ":     "C",
+		"Toggle root mode (ADB) ":               "#",
+		"Browse app data via run-as (ADB) ":     "@",
 		"Toggle hidden files ":                  "h, .",
+		"Toggle preserving file attributes ":    "t",
+		"Toggle verifying transferred files ":   "v",
+		"Toggle continuing jobs on errors ":     "e",
 		"Execute command":                       "!",
 		"Refresh ":                              "r",
 		"Move ":                                 "m",
 		"Paste/Put ":                            "p",
+		"Paste/Put (overwrite) ":                "P",
 		"Delete ":                               "d",
+		"Mirror directory to other pane ":       "=",
 		"Open files ":                           "Ctrl+o",
 		"Make directory ":                       "M",
 		"Rename files/folders ":                 "R",
@@ -771,10 +900,16 @@ func showHelp() {
 	}
 
 	opnsText := map[string]string{
-		"Navigate between entries ":  "Up, Down",
-		"Cancel selected operation ": "x",
-		"Cancel all operations ":     "X",
-		"Switch to main page ":       "o, Esc",
+		"Navigate between entries ":    "Up, Down",
+		"Cancel selected operation ":   "x",
+		"Resume/retry failed job ":     "r",
+		"Cancel all operations ":       "X",
+		"Dismiss finished operations ": "c",
+		"Pause/resume operation ":      "p",
+		"View errors of operation ":    "e",
+		"Move queued operation up ":    "[",
+		"Move queued operation down ":  "]",
+		"Switch to main page ":         "o, Esc",
 	}
 
 	cdirText := map[string]string{
@@ -793,6 +928,25 @@ func showHelp() {
 		"Cancel editing list ": "Esc",
 	}
 
+	deviceText := map[string]string{
+		"Navigate between entries ":          "Up, Down",
+		"Select highlighted device/package ": "Enter",
+		"Switch to main page ":               "Esc",
+	}
+
+	connText := map[string]string{
+		"Switch b/w Connect/Pair ":        "Ctrl+p",
+		"Cycle remembered endpoints ":     "Up, Down",
+		"Connect, or enter pairing code ": "Enter",
+	}
+
+	syncText := map[string]string{
+		"Navigate between entries ": "Up, Down",
+		"Skip/unskip entry ":        "Alt+Space",
+		"Run the sync plan ":        "Enter",
+		"Cancel the sync plan ":     "Esc",
+	}
+
 	execText := map[string]string{
 		"Switch b/w Local/Adb ":       "Ctrl+a",
 		"Switch b/w FG/BG execution ": "Ctrl+q",
@@ -828,6 +982,9 @@ func showHelp() {
 		opnsText,
 		cdirText,
 		editText,
+		deviceText,
+		connText,
+		syncText,
 		execText,
 	} {
 		var header string
@@ -846,6 +1003,15 @@ func showHelp() {
 			header = "EDIT SELECTION MODE"
 
 		case 4:
+			header = "DEVICE/PACKAGE SELECTION MODE"
+
+		case 5:
+			header = "CONNECTION MODE"
+
+		case 6:
+			header = "SYNC PLAN MODE"
+
+		case 7:
 			header = "EXECUTION MODE"
 		}
 
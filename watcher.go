@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	adb "github.com/zach-klippenstein/goadb"
+)
+
+var (
+	wctx    context.Context
+	wcancel context.CancelFunc
+)
+
+func startDeviceWatcher() {
+	wctx, wcancel = context.WithCancel(context.Background())
+
+	// The device watcher logs server restarts to stderr,
+	// which would otherwise be drawn over the UI.
+	log.SetOutput(ioutil.Discard)
+
+	go func() {
+		for {
+			watchDevices()
+
+			select {
+			case <-wctx.Done():
+				return
+
+			case <-time.After(2 * time.Second):
+			}
+		}
+	}()
+}
+
+func stopDeviceWatcher() {
+	if wcancel != nil {
+		wcancel()
+	}
+}
+
+func watchDevices() {
+	client, err := getClient()
+	if err != nil {
+		return
+	}
+
+	watcher := client.NewDeviceWatcher()
+	defer watcher.Shutdown()
+
+	for {
+		select {
+		case <-wctx.Done():
+			return
+
+		case event, ok := <-watcher.C():
+			if !ok {
+				return
+			}
+
+			if event.WentOffline() {
+				invalidateSession(event.Serial)
+			}
+
+			for _, pane := range []*dirPane{selPane, auxPane} {
+				pane.deviceStateHandler(event)
+			}
+		}
+	}
+}
+
+func (p *dirPane) deviceStateHandler(event adb.DeviceStateChangedEvent) {
+	if event.Serial != p.serial {
+		return
+	}
+
+	switch {
+	case event.WentOffline():
+		p.setOffline(true)
+
+	case event.CameOnline():
+		p.setOffline(false)
+	}
+}
+
+func (p *dirPane) setOffline(offline bool) {
+	p.waitLock()
+
+	switch {
+	case offline && p.mode == mAdb:
+		showErrorMsg(fmt.Errorf("Device %s disconnected", p.serial), false)
+
+		p.mode = mLocal
+		p.apath = p.path
+		p.path = p.dpath
+
+	case !offline && p.offline && p.mode == mLocal:
+		showInfoMsg("Device " + p.serial + " reconnected")
+
+		p.mode = mAdb
+		p.dpath = p.path
+		p.path = p.apath
+
+	default:
+		p.setUnlock()
+		return
+	}
+
+	p.offline = offline
+
+	p.setUnlock()
+
+	p.ChangeDir(false, false)
+}